@@ -0,0 +1,111 @@
+package fs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// ApplyAfero applies the PathOps to the directory at path in afs. The directory
+// is created if it does not already exist. ApplyAfero allows the same fixtures
+// to be used for code which accesses storage using an [afero.Fs].
+//
+// PathOps which can not be used with a [Manifest], such as [FromDir] and
+// [WithTimestamps], can not be used with ApplyAfero.
+func ApplyAfero(t assert.TestingT, afs afero.Fs, path string, ops ...PathOp) {
+	if ht, ok := t.(helperT); ok {
+		ht.Helper()
+	}
+
+	newDir := newDirectoryWithDefaults()
+	if !assert.Nil(t, applyPathOps(&directoryPath{directory: newDir}, ops)) {
+		return
+	}
+	assert.Nil(t, writeAferoDirectory(afs, path, newDir))
+}
+
+// ManifestFromAfero creates a [Manifest] by reading the directory at path in
+// afs. ManifestFromAfero can be used with [EqualManifest] to compare the
+// directory to an expected structure.
+func ManifestFromAfero(t assert.TestingT, afs afero.Fs, path string) Manifest {
+	if ht, ok := t.(helperT); ok {
+		ht.Helper()
+	}
+
+	manifest, err := manifestFromFS(afero.NewIOFS(afero.NewBasePathFs(afs, path)))
+	assert.Nil(t, err)
+	return manifest
+}
+
+func writeAferoDirectory(afs afero.Fs, path string, dir *directory) error {
+	if err := afs.MkdirAll(path, aferoMode(dir.mode, 0755)); err != nil {
+		return err
+	}
+	if err := chownAfero(afs, path, dir.resource); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(dir.items))
+	for name := range dir.items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == anyFile {
+			continue
+		}
+		fullpath := filepath.Join(path, filepath.FromSlash(name))
+		if err := writeAferoEntry(afs, fullpath, dir.items[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeAferoEntry(afs afero.Fs, path string, entry dirEntry) error {
+	switch typed := entry.(type) {
+	case *directory:
+		return writeAferoDirectory(afs, path, typed)
+	case *symlink:
+		linker, ok := afs.(afero.Linker)
+		if !ok {
+			return &os.LinkError{Op: "symlink", Old: typed.target, New: path, Err: afero.ErrNoSymlink}
+		}
+		return linker.SymlinkIfPossible(typed.target, path)
+	case *file:
+		var content []byte
+		if typed.content != nil && typed.content != anyFileContent {
+			var err error
+			content, err = io.ReadAll(typed.content)
+			typed.content.Close()
+			if err != nil {
+				return err
+			}
+		}
+		if err := afero.WriteFile(afs, path, content, aferoMode(typed.mode, defaultFileMode)); err != nil {
+			return err
+		}
+		return chownAfero(afs, path, typed.resource)
+	}
+	return nil
+}
+
+func chownAfero(afs afero.Fs, path string, r resource) error {
+	if r.uid == currentUID() && r.gid == currentGID() {
+		return nil
+	}
+	return afs.Chown(path, int(r.uid), int(r.gid))
+}
+
+// aferoMode returns the permission bits of mode, or fallback when the manifest
+// matches any mode.
+func aferoMode(mode, fallback os.FileMode) os.FileMode {
+	if mode == anyFileMode {
+		return fallback
+	}
+	return mode.Perm()
+}
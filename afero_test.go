@@ -0,0 +1,25 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyAfero(t *testing.T) {
+	afs := afero.NewMemMapFs()
+	ops := []PathOp{
+		WithFile("a", "content a", WithMode(0600)),
+		WithDir("s",
+			WithFile("b", "content b")),
+	}
+	ApplyAfero(t, afs, "/root", ops...)
+
+	content, err := afero.ReadFile(afs, "/root/s/b")
+	assert.Nil(t, err)
+	assert.Equal(t, "content b", string(content))
+
+	expected := Expected(t, append(ops, MatchAnyFileMode)...)
+	assert.True(t, EqualManifest(t, ManifestFromAfero(t, afs, "/root"), expected))
+}
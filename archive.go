@@ -0,0 +1,404 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ArchiveOption is an option for the functions which write a [Dir] to an
+// archive.
+type ArchiveOption func(*archiveOptions)
+
+type archiveOptions struct {
+	gzip bool
+}
+
+// WithGzip compresses the archive using gzip.
+func WithGzip() ArchiveOption {
+	return func(o *archiveOptions) {
+		o.gzip = true
+	}
+}
+
+func newArchiveOptions(opts []ArchiveOption) archiveOptions {
+	var o archiveOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WriteTar writes the contents of the directory to w as a tar archive. File
+// modes, ownership, and symlinks are preserved. Paths in the archive are
+// relative to the directory.
+func (d *Dir) WriteTar(w io.Writer, opts ...ArchiveOption) error {
+	o := newArchiveOptions(opts)
+	if o.gzip {
+		gz := gzip.NewWriter(w)
+		if err := writeTar(gz, d.path); err != nil {
+			gz.Close()
+			return err
+		}
+		return gz.Close()
+	}
+	return writeTar(w, d.path)
+}
+
+func writeTar(w io.Writer, root string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(root, func(path string, entry iofs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		return writeTarEntry(tw, root, path, entry)
+	})
+	if err != nil {
+		tw.Close()
+		return err
+	}
+	return tw.Close()
+}
+
+func writeTarEntry(tw *tar.Writer, root, path string, entry iofs.DirEntry) error {
+	info, err := entry.Info()
+	if err != nil {
+		return err
+	}
+	var target string
+	if info.Mode()&os.ModeSymlink != 0 {
+		if target, err = archiveLinkTarget(root, path); err != nil {
+			return err
+		}
+	}
+	header, err := tar.FileInfoHeader(info, filepath.ToSlash(target))
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(rel)
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// archiveLinkTarget returns the target of the symlink at path, as it is stored
+// in an archive of the directory root. An absolute target inside root is made
+// relative to the symlink, so that the archive can be extracted anywhere. Other
+// targets are returned unchanged.
+func archiveLinkTarget(root, path string) (string, error) {
+	target, err := os.Readlink(path)
+	if err != nil || !filepath.IsAbs(target) {
+		return target, err
+	}
+	if rel, err := filepath.Rel(root, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return target, nil
+	}
+	return filepath.Rel(filepath.Dir(path), target)
+}
+
+// WriteZip writes the contents of the directory to w as a zip archive. File
+// modes and symlinks are preserved where the zip format allows. Paths in the
+// archive are relative to the directory.
+func (d *Dir) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	err := filepath.WalkDir(d.path, func(path string, entry iofs.DirEntry, err error) error {
+		if err != nil || path == d.path {
+			return err
+		}
+		return writeZipEntry(zw, d.path, path, entry)
+	})
+	if err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+func writeZipEntry(zw *zip.Writer, root, path string, entry iofs.DirEntry) error {
+	info, err := entry.Info()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(rel)
+	switch {
+	case info.IsDir():
+		header.Name += "/"
+	case info.Mode().IsRegular():
+		header.Method = zip.Deflate
+	}
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := archiveLinkTarget(root, path)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, filepath.ToSlash(target))
+		return err
+	case info.Mode().IsRegular():
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	}
+	return nil
+}
+
+// ManifestFromTar creates a [Manifest] by reading the tar archive from r. The
+// manifest stores the structure and properties of the files in the archive.
+// ManifestFromTar can be used with [EqualManifest] to compare an archive to an
+// expected structure without extracting it.
+//
+// Directories which are not included in the archive, including the root, are
+// expected to have the default mode and ownership of [Expected].
+func ManifestFromTar(t assert.TestingT, r io.Reader) Manifest {
+	if ht, ok := t.(helperT); ok {
+		ht.Helper()
+	}
+
+	manifest, err := manifestFromTar(r)
+	assert.Nil(t, err)
+	return manifest
+}
+
+func manifestFromTar(r io.Reader) (Manifest, error) {
+	b := newArchiveBuilder()
+	if err := b.addTar(r); err != nil {
+		return Manifest{}, err
+	}
+	return Manifest{root: b.root}, nil
+}
+
+// ManifestFromZip creates a [Manifest] by reading the zip archive from r, which
+// is size bytes long. ManifestFromZip can be used with [EqualManifest] to compare
+// an archive to an expected structure without extracting it.
+//
+// Zip archives do not store ownership, so all entries are expected to be owned
+// by the current user.
+func ManifestFromZip(t assert.TestingT, r io.ReaderAt, size int64) Manifest {
+	if ht, ok := t.(helperT); ok {
+		ht.Helper()
+	}
+
+	manifest, err := manifestFromZip(r, size)
+	assert.Nil(t, err)
+	return manifest
+}
+
+func manifestFromZip(r io.ReaderAt, size int64) (Manifest, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return Manifest{}, err
+	}
+	b := newArchiveBuilder()
+	for _, f := range zr.File {
+		if err := b.addZipEntry(f); err != nil {
+			return Manifest{}, err
+		}
+	}
+	return Manifest{root: b.root}, nil
+}
+
+func (b *archiveBuilder) addZipEntry(f *zip.File) error {
+	res := newResource(f.Mode())
+	res.modTime = f.Modified
+	if f.Mode().IsDir() {
+		return b.addDirectory(f.Name, res)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	if f.Mode()&os.ModeSymlink != 0 {
+		return b.addEntry(f.Name, &symlink{resource: res, target: filepath.FromSlash(string(content))})
+	}
+	return b.addFile(f.Name, res, content)
+}
+
+// archiveBuilder creates a manifest from the entries in an archive. Archives
+// may list entries in any order, and may omit parent directories.
+type archiveBuilder struct {
+	root  *directory
+	files map[string]*file
+	// layer contains the paths added by the current image layer. It is nil
+	// unless the archives are image layers, see ManifestFromLayers.
+	layer map[string]bool
+}
+
+func newArchiveBuilder() *archiveBuilder {
+	return &archiveBuilder{
+		root:  newDirectoryWithDefaults(),
+		files: make(map[string]*file),
+	}
+}
+
+func (b *archiveBuilder) addTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		}
+		if err := b.addTarEntry(tr, header); err != nil {
+			return err
+		}
+	}
+}
+
+func (b *archiveBuilder) addTarEntry(tr *tar.Reader, header *tar.Header) error {
+	if b.layer != nil && strings.HasPrefix(path.Base(header.Name), whiteoutPrefix) {
+		return b.addWhiteout(header.Name)
+	}
+	res := resource{
+		mode:    header.FileInfo().Mode(),
+		uid:     uint32(header.Uid),
+		gid:     uint32(header.Gid),
+		modTime: header.ModTime,
+	}
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return b.addDirectory(header.Name, res)
+	case tar.TypeSymlink:
+		return b.addEntry(header.Name, &symlink{resource: res, target: filepath.FromSlash(header.Linkname)})
+	case tar.TypeLink:
+		target, ok := b.files[cleanArchivePath(header.Linkname)]
+		if !ok {
+			return fmt.Errorf("hardlink %s: target %s not found in archive", header.Name, header.Linkname)
+		}
+		content, err := io.ReadAll(target.content)
+		if err != nil {
+			return err
+		}
+		target.content = io.NopCloser(bytes.NewReader(content))
+		return b.addFile(header.Name, target.resource, content)
+	case tar.TypeReg:
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		return b.addFile(header.Name, res, content)
+	}
+	return nil
+}
+
+func (b *archiveBuilder) addFile(name string, res resource, content []byte) error {
+	f := &file{resource: res, content: io.NopCloser(bytes.NewReader(content))}
+	b.files[cleanArchivePath(name)] = f
+	return b.addEntry(name, f)
+}
+
+func (b *archiveBuilder) addDirectory(name string, res resource) error {
+	dir, err := b.directory(cleanArchivePath(name))
+	if err != nil {
+		return err
+	}
+	dir.resource = res
+	if b.layer != nil {
+		b.layer[cleanArchivePath(name)] = true
+	}
+	return nil
+}
+
+func (b *archiveBuilder) addEntry(name string, entry dirEntry) error {
+	name = cleanArchivePath(name)
+	parent, err := b.directory(path.Dir(name))
+	if err != nil {
+		return err
+	}
+	parent.items[path.Base(name)] = entry
+	if b.layer != nil {
+		b.layer[name] = true
+	}
+	return nil
+}
+
+// directory returns the directory at name, creating any directories which do
+// not exist.
+func (b *archiveBuilder) directory(name string) (*directory, error) {
+	dir := b.root
+	if name == "." {
+		return dir, nil
+	}
+	for _, part := range strings.Split(name, "/") {
+		switch typed := dir.items[part].(type) {
+		case nil:
+			newDir := newDirectoryWithDefaults()
+			newDir.mode = os.ModeDir | 0755
+			dir.items[part] = newDir
+			dir = newDir
+		case *directory:
+			dir = typed
+		default:
+			if b.layer == nil {
+				return nil, fmt.Errorf("%s: parent %s is a %s", name, part, typed.Type())
+			}
+			// a directory in an upper layer replaces a file in a lower layer
+			newDir := newDirectoryWithDefaults()
+			newDir.mode = os.ModeDir | 0755
+			dir.items[part] = newDir
+			dir = newDir
+		}
+	}
+	return dir, nil
+}
+
+// cleanArchivePath returns name as a clean slash separated path relative to the
+// root of the archive.
+func cleanArchivePath(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
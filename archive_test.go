@@ -0,0 +1,141 @@
+package fs_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fs "github.com/goslogan/assertfs"
+	"gotest.tools/v3/assert"
+)
+
+func TestDirWriteTar(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithFile("1", "content 1", fs.WithMode(0600)),
+		fs.WithDir("a",
+			fs.WithFile("2", "content 2")),
+		fs.WithSymlink("link", "1"),
+		fs.WithSymlink("a/up", "1"))
+	outside := t.TempDir()
+	assert.NilError(t, os.Symlink(outside, dir.Join("outside")))
+	assert.NilError(t, os.Symlink("a/2", dir.Join("relative")))
+
+	buf := new(bytes.Buffer)
+	assert.NilError(t, dir.WriteTar(buf, fs.WithGzip()))
+
+	gz, err := gzip.NewReader(buf)
+	assert.NilError(t, err)
+	tr := tar.NewReader(gz)
+
+	entries := map[string]*tar.Header{}
+	contents := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NilError(t, err)
+		entries[header.Name] = header
+		content, err := io.ReadAll(tr)
+		assert.NilError(t, err)
+		contents[header.Name] = string(content)
+	}
+
+	assert.Equal(t, len(entries), 7)
+	assert.Equal(t, entries["1"].Mode&0777, int64(0600))
+	assert.Equal(t, contents["1"], "content 1")
+	assert.Equal(t, entries["a/"].Typeflag, byte(tar.TypeDir))
+	assert.Equal(t, contents["a/2"], "content 2")
+	assert.Equal(t, entries["link"].Typeflag, byte(tar.TypeSymlink))
+	assert.Equal(t, entries["link"].Linkname, "1")
+	assert.Equal(t, entries["a/up"].Linkname, "../1")
+	assert.Equal(t, entries["outside"].Linkname, filepath.ToSlash(outside))
+	assert.Equal(t, entries["relative"].Linkname, "a/2")
+}
+
+func TestDirWriteZip(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithFile("1", "content 1", fs.WithMode(0600)),
+		fs.WithDir("a",
+			fs.WithFile("2", "content 2")))
+
+	buf := new(bytes.Buffer)
+	assert.NilError(t, dir.WriteZip(buf))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NilError(t, err)
+
+	entries := map[string]*zip.File{}
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+	assert.Equal(t, len(entries), 3)
+	assert.Equal(t, entries["1"].Mode().Perm(), os.FileMode(0600))
+	assert.Assert(t, entries["a/"].Mode().IsDir())
+
+	r, err := entries["a/2"].Open()
+	assert.NilError(t, err)
+	defer r.Close()
+	content, err := io.ReadAll(r)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "content 2")
+}
+
+func TestManifestFromTar(t *testing.T) {
+	ops := []fs.PathOp{
+		fs.WithFile("1", "content 1", fs.WithMode(0600)),
+		fs.WithDir("a",
+			fs.WithFile("2", "content 2"),
+			fs.WithDir("b", fs.WithMode(0700))),
+	}
+	dir := fs.NewDir(t, t.Name(), append(ops, fs.WithSymlink("link", "1"))...)
+
+	buf := new(bytes.Buffer)
+	assert.NilError(t, dir.WriteTar(buf))
+
+	expected := fs.Expected(t, append(ops, fs.WithSymlink("link", "1"))...)
+	assert.Assert(t, fs.EqualManifest(t, fs.ManifestFromTar(t, buf), expected))
+}
+
+func TestManifestFromTarImplicitDirectories(t *testing.T) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	assert.NilError(t, tw.WriteHeader(&tar.Header{
+		Name:     "./a/b/c",
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     3,
+		Uid:      os.Getuid(),
+		Gid:      os.Getgid(),
+	}))
+	_, err := tw.Write([]byte("abc"))
+	assert.NilError(t, err)
+	assert.NilError(t, tw.Close())
+
+	expected := fs.Expected(t,
+		fs.WithDir("a",
+			fs.WithDir("b",
+				fs.WithFile("c", "abc"))))
+	assert.Assert(t, fs.EqualManifest(t, fs.ManifestFromTar(t, buf), expected))
+}
+
+func TestManifestFromZip(t *testing.T) {
+	ops := []fs.PathOp{
+		fs.WithFile("1", "content 1", fs.WithMode(0600)),
+		fs.WithDir("a",
+			fs.WithFile("2", "content 2"),
+			fs.WithDir("b", fs.WithMode(0700))),
+	}
+	dir := fs.NewDir(t, t.Name(), ops...)
+
+	buf := new(bytes.Buffer)
+	assert.NilError(t, dir.WriteZip(buf))
+
+	manifest := fs.ManifestFromZip(t, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Assert(t, fs.EqualManifest(t, manifest, fs.Expected(t, ops...)))
+}
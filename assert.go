@@ -0,0 +1,166 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// AssertSameFile asserts that the paths a and b refer to the same file, for
+// example because one is a hard link to the other.
+func AssertSameFile(t assert.TestingT, a, b string) bool {
+	if ht, ok := t.(helperT); ok {
+		ht.Helper()
+	}
+
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return assert.Fail(t, "failed to stat file", err)
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return assert.Fail(t, "failed to stat file", err)
+	}
+	if !os.SameFile(aInfo, bInfo) {
+		return assert.Fail(t, "expected "+a+" and "+b+" to be the same file")
+	}
+	return true
+}
+
+// AssertExists asserts that path exists. A symlink exists even if its target
+// does not.
+func AssertExists(t assert.TestingT, path string) bool {
+	if ht, ok := t.(helperT); ok {
+		ht.Helper()
+	}
+
+	if _, err := os.Lstat(path); err != nil {
+		return assert.Fail(t, "expected "+path+" to exist", err)
+	}
+	return true
+}
+
+// AssertNotExists asserts that path does not exist.
+func AssertNotExists(t assert.TestingT, path string) bool {
+	if ht, ok := t.(helperT); ok {
+		ht.Helper()
+	}
+
+	info, err := os.Lstat(path)
+	switch {
+	case err == nil:
+		return assert.Fail(t, "expected "+path+" to not exist, got "+describeMode(info.Mode()))
+	case !os.IsNotExist(err):
+		return assert.Fail(t, "failed to stat file", err)
+	}
+	return true
+}
+
+// AssertIsDir asserts that path is a directory. A symlink to a directory is not
+// a directory.
+func AssertIsDir(t assert.TestingT, path string) bool {
+	if ht, ok := t.(helperT); ok {
+		ht.Helper()
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return assert.Fail(t, "failed to stat file", err)
+	}
+	if !info.IsDir() {
+		return assert.Fail(t, "expected "+path+" to be a directory, got "+describeMode(info.Mode()))
+	}
+	return true
+}
+
+// AssertIsSymlink asserts that path is a symlink. If target is not empty the
+// symlink must also link to target.
+func AssertIsSymlink(t assert.TestingT, path, target string) bool {
+	if ht, ok := t.(helperT); ok {
+		ht.Helper()
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return assert.Fail(t, "failed to stat file", err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return assert.Fail(t, "expected "+path+" to be a symlink, got "+describeMode(info.Mode()))
+	}
+	if target == "" {
+		return true
+	}
+	actual, err := os.Readlink(path)
+	if err != nil {
+		return assert.Fail(t, "failed to read symlink", err)
+	}
+	if actual != target {
+		return assert.Fail(t, "expected "+path+" to link to "+target+", got "+actual)
+	}
+	return true
+}
+
+// AssertFileContains asserts that the content of the file at path contains
+// substr. The failure message includes the content of the file.
+func AssertFileContains(t assert.TestingT, path, substr string) bool {
+	if ht, ok := t.(helperT); ok {
+		ht.Helper()
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return assert.Fail(t, "failed to read file", err)
+	}
+	if !strings.Contains(string(content), substr) {
+		return assert.Fail(t, contentFailure(path, "contain", substr, content))
+	}
+	return true
+}
+
+// AssertFileMatches asserts that the content of the file at path matches the
+// regular expression pattern. The failure message includes the content of the
+// file.
+func AssertFileMatches(t assert.TestingT, path, pattern string) bool {
+	if ht, ok := t.(helperT); ok {
+		ht.Helper()
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return assert.Fail(t, "invalid pattern", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return assert.Fail(t, "failed to read file", err)
+	}
+	if !re.Match(content) {
+		return assert.Fail(t, contentFailure(path, "match", pattern, content))
+	}
+	return true
+}
+
+// contentFailure returns a failure message which shows the expected value and
+// the content of a file, prefixed like a diff.
+func contentFailure(path, verb, want string, content []byte) string {
+	if isBinary(content) {
+		return fmt.Sprintf("expected %s to %s %q, got %d bytes of binary content", path, verb, want, len(content))
+	}
+	return fmt.Sprintf("expected %s to %s:\n%s\ncontent:\n%s", path, verb,
+		indent(want, "- "), indent(strings.TrimSuffix(string(content), "\n"), "+ "))
+}
+
+// describeMode returns the type of a file with mode, for failure messages.
+func describeMode(mode os.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return "directory"
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode.IsRegular():
+		return "file"
+	}
+	return "file with mode " + mode.String()
+}
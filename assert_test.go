@@ -0,0 +1,108 @@
+package fs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestAssertSameFile(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("a", "content"),
+		WithFile("c", "content"),
+		WithHardlink("b", "a"))
+	defer dir.Remove()
+
+	assert.Assert(t, AssertSameFile(t, dir.Join("a"), dir.Join("b")))
+
+	fake := &fakeT{}
+	assert.Assert(t, !AssertSameFile(fake, dir.Join("a"), dir.Join("c")))
+	assert.Assert(t, fake.failed)
+}
+
+func TestAssertExistence(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "content"),
+		WithDir("sub"),
+		WithSymlink("link", "file1"),
+		WithSymlink("dangling", "missing"))
+	defer dir.Remove()
+
+	assert.Assert(t, AssertExists(t, dir.Join("file1")))
+	assert.Assert(t, AssertExists(t, dir.Join("dangling")))
+	assert.Assert(t, AssertNotExists(t, dir.Join("missing")))
+	assert.Assert(t, AssertIsDir(t, dir.Join("sub")))
+	assert.Assert(t, AssertIsSymlink(t, dir.Join("link"), ""))
+	assert.Assert(t, AssertIsSymlink(t, dir.Join("link"), dir.Join("file1")))
+
+	for name, check := range map[string]func(t *fakeT) bool{
+		"exists":         func(t *fakeT) bool { return AssertExists(t, dir.Join("missing")) },
+		"not exists":     func(t *fakeT) bool { return AssertNotExists(t, dir.Join("file1")) },
+		"is dir":         func(t *fakeT) bool { return AssertIsDir(t, dir.Join("file1")) },
+		"is symlink":     func(t *fakeT) bool { return AssertIsSymlink(t, dir.Join("sub"), "") },
+		"symlink target": func(t *fakeT) bool { return AssertIsSymlink(t, dir.Join("link"), "other") },
+	} {
+		fake := &fakeT{}
+		assert.Assert(t, !check(fake), name)
+		assert.Assert(t, fake.failed, name)
+	}
+}
+
+func TestAssertFileContent(t *testing.T) {
+	file := NewFile(t, t.Name(), WithContent("first line\nversion: 1.2.3\n"))
+	defer file.Remove()
+
+	assert.Assert(t, AssertFileContains(t, file.Path(), "version: 1.2"))
+	assert.Assert(t, AssertFileMatches(t, file.Path(), `(?m)^version: \d+\.\d+\.\d+$`))
+
+	fake := &fakeT{}
+	assert.Assert(t, !AssertFileContains(fake, file.Path(), "version: 2"))
+	for _, line := range []string{"expected " + file.Path() + " to contain:", "- version: 2", "+ first line", "+ version: 1.2.3"} {
+		assert.Assert(t, strings.Contains(fake.message, line), fake.message)
+	}
+
+	fake = &fakeT{}
+	assert.Assert(t, !AssertFileMatches(fake, file.Path(), `^version`))
+	assert.Assert(t, strings.Contains(fake.message, "- ^version"), fake.message)
+
+	fake = &fakeT{}
+	assert.Assert(t, !AssertFileMatches(fake, file.Path(), `(`))
+	assert.Assert(t, strings.Contains(fake.message, "invalid pattern"), fake.message)
+}
+
+func TestEqualWithMatchSameFile(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("a", "content"),
+		WithFile("c", "content"),
+		WithHardlink("b", "a"))
+	defer dir.Remove()
+
+	manifest := Expected(t,
+		WithFile("a", "content"),
+		WithFile("b", "content", MatchSameFile("a")),
+		WithFile("c", "content"))
+	assert.Assert(t, Equal(t, dir.Path(), manifest))
+
+	manifest = Expected(t,
+		WithFile("a", "content"),
+		WithFile("b", "content"),
+		WithFile("c", "content", MatchSameFile("a")))
+	result := Compare(dir.Path(), manifest)
+	assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/c
+  link: expected same file as a got different file
+`, dir.Path()))
+}
+
+// fakeT records failures instead of failing the test.
+type fakeT struct {
+	failed  bool
+	message string
+}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.failed = true
+	f.message += fmt.Sprintf(format, args...)
+}
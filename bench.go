@@ -0,0 +1,66 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// BenchDir is a temporary directory for a benchmark, which can be restored to
+// its initial state between iterations.
+type BenchDir struct {
+	Dir
+	b        *testing.B
+	snapshot string
+}
+
+// NewBenchDir creates a temporary directory using prefix as part of the
+// directory name, and applies the PathOps to it, with the benchmark timer
+// stopped. The time taken to create the directory is reported as the
+// setup-ms metric, so that it is shown separately from the time per
+// iteration. The directory is removed when the benchmark ends.
+//
+// A snapshot of the directory is kept so that [BenchDir.Reset] can restore
+// it when an iteration modifies the directory.
+func NewBenchDir(b *testing.B, prefix string, ops ...PathOp) *BenchDir {
+	b.Helper()
+	b.StopTimer()
+	defer b.StartTimer()
+
+	start := time.Now()
+	path, err := os.MkdirTemp("", cleanPrefix(prefix)+"-")
+	assert.Nil(b, err)
+	dir := &BenchDir{Dir: Dir{path: path}, b: b}
+	register(path)
+	removeOnCleanup(b, &dir.Dir, dir.RemoveE)
+	assert.Nil(b, applyPathOps(&dir.Dir, ops))
+
+	dir.snapshot, err = os.MkdirTemp("", cleanPrefix(prefix)+"-snapshot-")
+	assert.Nil(b, err)
+	snapshot := &Dir{path: dir.snapshot}
+	register(snapshot.path)
+	removeOnCleanup(b, snapshot, snapshot.RemoveE)
+	assert.Nil(b, copyTree(dir.path, dir.snapshot))
+
+	b.ReportMetric(float64(time.Since(start).Microseconds())/1000, "setup-ms")
+	return dir
+}
+
+// Reset restores the directory to its state after the PathOps passed to
+// [NewBenchDir] were applied. The benchmark timer is stopped while the
+// directory is restored.
+func (d *BenchDir) Reset() {
+	d.b.Helper()
+	d.b.StopTimer()
+	defer d.b.StartTimer()
+
+	entries, err := os.ReadDir(d.path)
+	assert.Nil(d.b, err)
+	for _, entry := range entries {
+		assert.Nil(d.b, os.RemoveAll(filepath.Join(d.path, entry.Name())))
+	}
+	assert.Nil(d.b, copyTree(d.snapshot, d.path))
+}
@@ -0,0 +1,42 @@
+package fs_test
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	fs "github.com/goslogan/assertfs"
+	"gotest.tools/v3/assert"
+)
+
+func TestNewBenchDir(t *testing.T) {
+	// Limit the iterations, because the untimed Reset makes every timed
+	// iteration slow.
+	benchtime := flag.Lookup("test.benchtime").Value.String()
+	assert.NilError(t, flag.Set("test.benchtime", "10x"))
+	defer flag.Set("test.benchtime", benchtime)
+
+	var failed bool
+	result := testing.Benchmark(func(b *testing.B) {
+		dir := fs.NewBenchDir(b, "bench",
+			fs.WithFile("file1", "content", fs.WithMode(0600)),
+			fs.WithDir("sub", fs.WithFile("file2", "content")))
+		for i := 0; i < b.N; i++ {
+			dir.Reset()
+			if err := os.WriteFile(dir.Join("file1"), []byte("changed"), 0644); err != nil {
+				b.Fatal(err)
+			}
+			if err := os.RemoveAll(dir.Join("sub")); err != nil {
+				b.Fatal(err)
+			}
+		}
+		dir.Reset()
+		failed = !fs.Compare(dir.Path(), fs.Expected(t,
+			fs.MatchAnyFileMode,
+			fs.WithFile("file1", "content", fs.WithMode(0600)),
+			fs.WithDir("sub", fs.WithFile("file2", "content")))).Success()
+	})
+	assert.Assert(t, !failed)
+	_, ok := result.Extra["setup-ms"]
+	assert.Assert(t, ok)
+}
@@ -0,0 +1,236 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fixtureCache stores the directories created by NewCachedDir, keyed by the
+// hash of the manifest of their PathOps.
+var fixtureCache = struct {
+	sync.Mutex
+	fixtures map[string]*cachedFixture
+}{fixtures: make(map[string]*cachedFixture)}
+
+type cachedFixture struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+// NewCachedDir returns a new temporary directory, like [NewDir], which contains
+// a clone of a cached directory created by applying the PathOps. The cached
+// directory is created the first time NewCachedDir is called with PathOps that
+// create the same files, and is reused by every later call, so that a large
+// fixture is only built once per test binary.
+//
+// Files without write permission are hardlinked from the cached directory when
+// the filesystem supports it, because they can not be modified by the test.
+// Other files are copied, and are owned by the current user. Symlinks to files
+// in the cached directory link to the same file in the clone.
+//
+// PathOps which can not be applied to a [Manifest], such as [FromDir], PathOps
+// which have no effect on a Manifest, and PathOps which set an expectation,
+// such as [MatchContentRegexp], can not be hashed, and NewCachedDir creates a
+// new directory with them every time. So can [WithReaderContent], because its
+// reader can only be read once.
+//
+// Use [RemoveFixtureCache] in TestMain to remove the cached directories once
+// the tests are done.
+func NewCachedDir(t *testing.T, prefix string, ops ...PathOp) *Dir {
+	t.Helper()
+	fixture, ok := cachedFixturePath(t, ops)
+	if !ok {
+		return NewDir(t, prefix, ops...)
+	}
+	dir := NewDir(t, prefix)
+	assert.Nil(t, cloneTree(fixture, dir.Path()))
+	return dir
+}
+
+// NewOverlayDir returns a new temporary directory, like [NewCachedDir], which
+// contains the files created by the PathOps. On Linux, when the test has
+// permission to mount filesystems, the directory is an overlayfs mount with the
+// cached directory as its read-only lower layer. Changes made by the test are
+// written to an upper layer which is removed with the directory, so destructive
+// tests can share one expensive tree without copying it. Otherwise the cached
+// directory is cloned as it is by NewCachedDir.
+func NewOverlayDir(t *testing.T, prefix string, ops ...PathOp) *Dir {
+	t.Helper()
+	fixture, ok := cachedFixturePath(t, ops)
+	if !ok {
+		return NewDir(t, prefix, ops...)
+	}
+	dir := NewDir(t, prefix)
+	layers := NewDir(t, prefix+"-layers", WithDir("upper"), WithDir("work"))
+	if err := mountOverlay(fixture, layers.Join("upper"), layers.Join("work"), dir.Path()); err != nil {
+		assert.Nil(t, cloneTree(fixture, dir.Path()))
+		return dir
+	}
+	t.Cleanup(func() {
+		assert.Nil(t, unmountOverlay(dir.Path()))
+	})
+	return dir
+}
+
+// cachedFixturePath returns the path of the cached directory created by ops,
+// creating it if it is not cached. It returns false if ops can not be hashed.
+func cachedFixturePath(t *testing.T, ops []PathOp) (string, bool) {
+	t.Helper()
+	key, err := hashPathOps(ops)
+	if err != nil {
+		return "", false
+	}
+
+	fixtureCache.Lock()
+	fixture, ok := fixtureCache.fixtures[key]
+	if !ok {
+		fixture = &cachedFixture{}
+		fixtureCache.fixtures[key] = fixture
+	}
+	fixtureCache.Unlock()
+
+	fixture.once.Do(func() {
+		fixture.path, fixture.err = os.MkdirTemp("", "fstest-cache-"+key[:12]+"-")
+		if fixture.err == nil {
+			register(fixture.path)
+			fixture.err = applyPathOps(&Dir{path: fixture.path}, ops)
+		}
+	})
+	assert.Nil(t, fixture.err)
+	return fixture.path, true
+}
+
+// RemoveFixtureCache removes the directories cached by [NewCachedDir].
+func RemoveFixtureCache() {
+	fixtureCache.Lock()
+	defer fixtureCache.Unlock()
+	for key, fixture := range fixtureCache.fixtures {
+		if fixture.path != "" {
+			_ = (&Dir{path: fixture.path}).RemoveE()
+		}
+		delete(fixtureCache.fixtures, key)
+	}
+}
+
+// cloneTree copies the cached directory source to dest, hardlinking the files
+// which can not be written.
+func cloneTree(source, dest string) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	err = copyTreeWith(source, dest, func(sourcePath, destPath string, info os.FileInfo) (bool, error) {
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(sourcePath)
+			if err != nil {
+				return false, err
+			}
+			if rel, err := filepath.Rel(source, target); err == nil && filepath.IsAbs(target) && !strings.HasPrefix(rel, "..") {
+				target = filepath.Join(dest, rel)
+			}
+			return true, os.Symlink(target, destPath)
+		}
+		if info.Mode().Perm()&0222 == 0 && os.Link(sourcePath, destPath) == nil {
+			return true, nil
+		}
+		return false, copyFile(sourcePath, destPath)
+	})
+	if err != nil {
+		return err
+	}
+	return os.Chmod(dest, info.Mode().Perm())
+}
+
+// hashPathOps returns a key for the files created by ops, computed from the
+// Manifest created by applying ops. It returns an error if an op can not be
+// represented in a Manifest, because the key would not identify the files it
+// creates. That is an op which fails, or has no effect, when it is applied to
+// a Manifest, or which sets an expectation instead of a property of a file.
+// The content set by WithReaderContent is not hashed, because reading it would
+// leave nothing to write to the cached directory.
+func hashPathOps(ops []PathOp) (string, error) {
+	root := newDirectoryWithDefaults()
+	previous, err := hashDirectory(root)
+	if err != nil {
+		return "", err
+	}
+	for i, op := range ops {
+		if err := applyPathOps(&directoryPath{directory: root}, []PathOp{op}); err != nil {
+			return "", err
+		}
+		key, err := hashDirectory(root)
+		if err != nil {
+			return "", err
+		}
+		if key == previous {
+			return "", fmt.Errorf("PathOp %d has no effect on a manifest", i)
+		}
+		previous = key
+	}
+	return previous, nil
+}
+
+func hashDirectory(root *directory) (string, error) {
+	h := sha256.New()
+	if err := hashEntry(h, root); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func hashEntry(h hash.Hash, entry dirEntry) error {
+	switch typed := entry.(type) {
+	case *directory:
+		if typed.anyContents || len(typed.filepathGlobs) > 0 || len(typed.aggregates) > 0 || !isHashable(typed.resource) {
+			return fmt.Errorf("can not hash the expectations of a directory")
+		}
+		fmt.Fprintf(h, "dir %v %d %d %d\n", typed.mode, typed.uid, typed.gid, len(typed.items))
+		for _, name := range sortedKeys(typed.items) {
+			fmt.Fprintf(h, "%q\n", name)
+			if err := hashEntry(h, typed.items[name]); err != nil {
+				return err
+			}
+		}
+	case *file:
+		if _, ok := typed.content.(readerContent); ok {
+			return fmt.Errorf("can not hash content read from an io.Reader")
+		}
+		switch {
+		case typed.content == nil, typed.content == anyFileContent, typed.compareContentFunc != nil,
+			typed.contentFunc != nil, typed.readerFunc != nil, len(typed.matchers) > 0,
+			typed.sameFileAs != "", typed.extents != nil, !isHashable(typed.resource):
+			return fmt.Errorf("can not hash the expectations of a file")
+		}
+		fmt.Fprintf(h, "file %v %d %d\n", typed.mode, typed.uid, typed.gid)
+		content, err := readAll(typed.content)
+		typed.content = io.NopCloser(bytes.NewReader(content))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%d\n", len(content))
+		_, err = h.Write(content)
+		return err
+	case *symlink:
+		fmt.Fprintf(h, "symlink %q\n", typed.target)
+	default:
+		return fmt.Errorf("can not hash %s", entry.Type())
+	}
+	return nil
+}
+
+// isHashable returns true if res only has the properties of an actual
+// resource, and no other expectations.
+func isHashable(res resource) bool {
+	return res.modeMask == 0 && res.owner == "" && res.group == "" && res.matchModTime == nil
+}
@@ -0,0 +1,93 @@
+package fs_test
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	fs "github.com/goslogan/assertfs"
+	"gotest.tools/v3/assert"
+)
+
+func TestNewCachedDir(t *testing.T) {
+	t.Cleanup(fs.RemoveFixtureCache)
+	ops := []fs.PathOp{
+		fs.WithFile("writable", "content"),
+		fs.WithFile("readonly", "content", fs.WithMode(0444)),
+		fs.WithSymlink("link", "writable"),
+	}
+	first := fs.NewCachedDir(t, t.Name(), ops...)
+	second := fs.NewCachedDir(t, t.Name(), ops...)
+
+	assert.NilError(t, os.WriteFile(first.Join("writable"), []byte("changed"), 0644))
+	content, err := os.ReadFile(second.Join("link"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "content")
+
+	if runtime.GOOS != "windows" {
+		assert.Assert(t, sameFile(t, first.Join("readonly"), second.Join("readonly")))
+		other := fs.NewCachedDir(t, t.Name(), append(ops, fs.WithFile("other", ""))...)
+		assert.Assert(t, !sameFile(t, first.Join("readonly"), other.Join("readonly")))
+	}
+}
+
+func TestNewCachedDirWithOpsNotInManifest(t *testing.T) {
+	t.Cleanup(fs.RemoveFixtureCache)
+	// Both ops have no effect on a Manifest, and must not share a fixture.
+	withRawFile := func(content string) fs.PathOp {
+		return func(path fs.Path) error {
+			if dir, ok := path.(*fs.Dir); ok {
+				return os.WriteFile(dir.Join("raw"), []byte(content), 0444)
+			}
+			return nil
+		}
+	}
+	first := fs.NewCachedDir(t, t.Name(), fs.WithFile("file", ""), withRawFile("first"))
+	second := fs.NewCachedDir(t, t.Name(), fs.WithFile("file", ""), withRawFile("second"))
+
+	content, err := os.ReadFile(first.Join("raw"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "first")
+	content, err = os.ReadFile(second.Join("raw"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "second")
+
+	first = fs.NewCachedDir(t, t.Name(), fs.WithFile("file", "content", fs.WithTimestamps(time.Unix(0, 0), time.Unix(0, 0))))
+	info, err := os.Stat(first.Join("file"))
+	assert.NilError(t, err)
+	assert.Assert(t, info.ModTime().Equal(time.Unix(0, 0)))
+
+	first = fs.NewCachedDir(t, t.Name(), fs.WithFile("file", "", fs.WithReaderContent(strings.NewReader("payload"))))
+	content, err = os.ReadFile(first.Join("file"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "payload")
+}
+
+func sameFile(t *testing.T, x, y string) bool {
+	t.Helper()
+	xInfo, err := os.Stat(x)
+	assert.NilError(t, err)
+	yInfo, err := os.Stat(y)
+	assert.NilError(t, err)
+	return os.SameFile(xInfo, yInfo)
+}
+
+func TestNewOverlayDir(t *testing.T) {
+	t.Cleanup(fs.RemoveFixtureCache)
+	ops := []fs.PathOp{
+		fs.WithFile("file1", "content"),
+		fs.WithDir("sub", fs.WithFile("file2", "content")),
+	}
+	first := fs.NewOverlayDir(t, t.Name(), ops...)
+	second := fs.NewOverlayDir(t, t.Name(), ops...)
+
+	assert.NilError(t, os.WriteFile(first.Join("file1"), []byte("changed"), 0644))
+	assert.NilError(t, os.RemoveAll(first.Join("sub")))
+	expected := fs.Expected(t,
+		fs.MatchAnyFileMode,
+		fs.WithFile("file1", "content", fs.MatchAnyFileMode),
+		fs.WithDir("sub", fs.MatchAnyFileMode, fs.WithFile("file2", "content", fs.MatchAnyFileMode)))
+	assert.Assert(t, fs.Equal(t, second.Path(), expected))
+}
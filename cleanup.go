@@ -0,0 +1,159 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// CleanupPolicy decides if a [Dir] or [File] is kept when the test which
+// created it ends, instead of being removed. It returns true if the files
+// should be kept.
+type CleanupPolicy func(t testing.TB) bool
+
+var (
+	// CleanupDelete is a [CleanupPolicy] which always removes the files. It is
+	// the default.
+	CleanupDelete CleanupPolicy = func(testing.TB) bool { return false }
+	// CleanupKeep is a [CleanupPolicy] which always keeps the files.
+	CleanupKeep CleanupPolicy = func(testing.TB) bool { return true }
+	// CleanupKeepOnFailure is a [CleanupPolicy] which keeps the files when the
+	// test fails.
+	CleanupKeepOnFailure CleanupPolicy = func(t testing.TB) bool { return t.Failed() }
+)
+
+// CleanupKeepMatching returns a [CleanupPolicy] which keeps the files of tests
+// with a name which matches the regular expression pattern.
+func CleanupKeepMatching(pattern string) CleanupPolicy {
+	re := regexp.MustCompile(pattern)
+	return func(t testing.TB) bool {
+		return re.MatchString(t.Name())
+	}
+}
+
+// packagePolicy is set by SetCleanupPolicy.
+var packagePolicy atomic.Pointer[CleanupPolicy]
+
+// WithCleanupPolicy is a [PathOp] which sets the [CleanupPolicy] of a [Dir] or
+// [File] created by [NewDir] or [NewFile]. When used with a [Manifest]
+// WithCleanupPolicy has no effect.
+//
+// The policy for every Dir and File can be set with the FSTEST_CLEANUP env
+// var, which overrides the policy set by WithCleanupPolicy or
+// [SetCleanupPolicy]. It may be one of delete, keep, keep-on-failure, or
+// keep-matching=pattern. Setting TEST_NOCLEANUP to true is the same as
+// FSTEST_CLEANUP=keep.
+func WithCleanupPolicy(policy CleanupPolicy) PathOp {
+	return func(path Path) error {
+		switch typed := path.(type) {
+		case *Dir:
+			typed.cleanupPolicy = policy
+		case *File:
+			typed.cleanupPolicy = policy
+		}
+		return nil
+	}
+}
+
+// KeepOnFailure is a [PathOp] which keeps a [Dir] or [File] created by [NewDir]
+// or [NewFile] when the test fails, instead of removing it when the test ends.
+// The path is logged so that the state which caused the failure can be
+// inspected. It is the same as WithCleanupPolicy(CleanupKeepOnFailure).
+func KeepOnFailure() PathOp {
+	return WithCleanupPolicy(CleanupKeepOnFailure)
+}
+
+// SetCleanupPolicy sets the [CleanupPolicy] of every [Dir] and [File] which is
+// not created with [WithCleanupPolicy]. It is usually called from TestMain.
+// A nil policy restores the default, [CleanupDelete].
+func SetCleanupPolicy(policy CleanupPolicy) {
+	if policy == nil {
+		packagePolicy.Store(nil)
+		return
+	}
+	packagePolicy.Store(&policy)
+}
+
+// SetKeepOnFailure changes whether every [Dir] and [File] is kept when the test
+// which created it fails, as if it was created with [KeepOnFailure]. It is the
+// same as SetCleanupPolicy(CleanupKeepOnFailure).
+func SetKeepOnFailure(keep bool) {
+	if keep {
+		SetCleanupPolicy(CleanupKeepOnFailure)
+		return
+	}
+	SetCleanupPolicy(nil)
+}
+
+// cleanupPolicy returns the policy for path, in order of precedence from the
+// env, the path, and the package.
+func cleanupPolicy(path Path) (CleanupPolicy, error) {
+	if policy, err := cleanupPolicyFromEnv(); policy != nil || err != nil {
+		return policy, err
+	}
+	switch typed := path.(type) {
+	case *Dir:
+		if typed.cleanupPolicy != nil {
+			return typed.cleanupPolicy, nil
+		}
+	case *File:
+		if typed.cleanupPolicy != nil {
+			return typed.cleanupPolicy, nil
+		}
+	}
+	if policy := packagePolicy.Load(); policy != nil {
+		return *policy, nil
+	}
+	return CleanupDelete, nil
+}
+
+func cleanupPolicyFromEnv() (CleanupPolicy, error) {
+	value := os.Getenv("FSTEST_CLEANUP")
+	switch {
+	case value == "delete":
+		return CleanupDelete, nil
+	case value == "keep":
+		return CleanupKeep, nil
+	case value == "keep-on-failure":
+		return CleanupKeepOnFailure, nil
+	case strings.HasPrefix(value, "keep-matching="):
+		pattern := strings.TrimPrefix(value, "keep-matching=")
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid FSTEST_CLEANUP: %w", err)
+		}
+		return CleanupKeepMatching(pattern), nil
+	case value != "":
+		return nil, fmt.Errorf("invalid FSTEST_CLEANUP: %q", value)
+	}
+	if noCleanup, _ := strconv.ParseBool(os.Getenv("TEST_NOCLEANUP")); noCleanup {
+		return CleanupKeep, nil
+	}
+	return nil, nil
+}
+
+// removeOnCleanup calls remove when the test ends, and logs a warning with the
+// error if path can not be removed, so that leaked temporary files are visible
+// in the test output. If the cleanup policy keeps path, it is logged instead of
+// being removed.
+func removeOnCleanup(t testing.TB, path Path, remove func() error) {
+	t.Cleanup(func() {
+		policy, err := cleanupPolicy(path)
+		switch {
+		case err != nil:
+			t.Logf("warning: %s", err)
+		case policy(t) && t.Failed():
+			t.Logf("keeping %s because the test failed", path.Path())
+			return
+		case policy(t):
+			t.Logf("keeping %s", path.Path())
+			return
+		}
+		if err := remove(); err != nil {
+			t.Logf("warning: failed to remove %s: %s", path.Path(), err)
+		}
+	})
+}
@@ -0,0 +1,17 @@
+package fs
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile creates dest as a copy-on-write clone of source using clonefile,
+// which is supported by APFS. An error is returned if the filesystem does not
+// support cloning.
+func cloneFile(source, dest string) error {
+	if err := unix.Clonefile(source, dest, unix.CLONE_NOFOLLOW); err != nil {
+		return err
+	}
+	return os.Chmod(dest, 0644)
+}
@@ -0,0 +1,33 @@
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl, which makes dest share the extents of source on
+// filesystems which support reflinks, such as Btrfs and XFS.
+const ficlone = 0x40049409
+
+// cloneFile creates dest as a copy-on-write clone of source. An error is
+// returned if the filesystem does not support cloning.
+func cloneFile(source, dest string) error {
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	if err := dst.Close(); errno == 0 && err != nil {
+		errno = syscall.EIO
+	}
+	if errno != 0 {
+		_ = os.Remove(dest)
+		return errno
+	}
+	return nil
+}
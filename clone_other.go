@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package fs
+
+import "errors"
+
+func cloneFile(source, dest string) error {
+	return errors.New("cloning files is not supported on this platform")
+}
@@ -0,0 +1,26 @@
+package fs
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCopyFile(t *testing.T) {
+	dir := NewDir(t, t.Name(), WithFile("source", "content", WithMode(0600)))
+	defer dir.Remove()
+
+	// The file is cloned if the filesystem supports it, and is copied
+	// otherwise. Either way the copy has the default mode.
+	assert.NilError(t, copyFile(dir.Join("source"), dir.Join("dest")))
+	content, err := os.ReadFile(dir.Join("dest"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "content")
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(dir.Join("dest"))
+		assert.NilError(t, err)
+		assert.Equal(t, info.Mode(), os.FileMode(0644))
+	}
+}
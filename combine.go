@@ -0,0 +1,226 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+)
+
+// unsetID is the uid or gid of a file in a combined matcher which does not
+// expect an owner, so the owner of the actual file is not compared.
+const unsetID = ^uint32(0)
+
+// AllOf is a [PathOp] that updates a [Manifest] so that the file at path must
+// match every one of ops, for example
+//
+//	AllOf(MatchContentRegexp(`^v\d+`), MatchSizeBetween(0, 1024))
+//
+// Unlike applying the ops directly, the expectations of every op are checked,
+// instead of the last op replacing the expectations set by the others.
+func AllOf(ops ...PathOp) PathOp {
+	return combine(ops, func(results [][]problem) []problem {
+		var p []problem
+		for _, result := range results {
+			p = append(p, result...)
+		}
+		return p
+	})
+}
+
+// AnyOf is a [PathOp] that updates a [Manifest] so that the file at path must
+// match at least one of ops. AnyOf returns an error if ops is empty, because no
+// file could match it.
+func AnyOf(ops ...PathOp) PathOp {
+	if len(ops) == 0 {
+		return func(Path) error {
+			return errors.New("AnyOf requires at least one PathOp")
+		}
+	}
+	return combine(ops, func(results [][]problem) []problem {
+		var messages []string
+		for _, result := range results {
+			if len(result) == 0 {
+				return nil
+			}
+			messages = append(messages, problemMessages(result))
+		}
+		return []problem{{
+			kind:    results[0][0].kind,
+			message: "does not match any of:\n" + indent(strings.Join(messages, "\n"), "    "),
+		}}
+	})
+}
+
+// Not is a [PathOp] that updates a [Manifest] so that the file at path must not
+// match ops, for example Not(MatchContentRegexp("ERROR")). The file matches ops
+// if it matches all of them, as with [AllOf].
+func Not(ops ...PathOp) PathOp {
+	return combine(ops, func(results [][]problem) []problem {
+		for _, result := range results {
+			if len(result) > 0 {
+				return nil
+			}
+		}
+		return []problem{{kind: MismatchContent, message: "matches, but expected not to match"}}
+	})
+}
+
+func problemMessages(problems []problem) string {
+	messages := make([]string, 0, len(problems))
+	for _, p := range problems {
+		messages = append(messages, "- "+strings.ReplaceAll(p.message, "\n", "\n  "))
+	}
+	return strings.Join(messages, "\n")
+}
+
+// fileMatcher compares an actual file to an expectation which replaces the
+// comparison of content, such as the matcher set by [AllOf].
+type fileMatcher func(opts *compareOptions, path string, actual *file) []problem
+
+// combine applies each op to a separate file, and adds a matcher which
+// compares the actual file to each of them and combines the results. The
+// matchers already set on the file are kept, and the expected content of the
+// file is also checked when the file is compared.
+func combine(ops []PathOp, combineResults func(results [][]problem) []problem) PathOp {
+	return func(path Path) error {
+		m, ok := path.(*filePath)
+		if !ok {
+			return nil
+		}
+		expected := make([]scratchFile, 0, len(ops))
+		for _, op := range ops {
+			s, err := newScratchFile(op)
+			if err != nil {
+				return err
+			}
+			expected = append(expected, s)
+		}
+		m.file.matchers = append(m.file.matchers, func(opts *compareOptions, path string, actual *file) []problem {
+			content, err := readAll(actual.content)
+			if err != nil {
+				return []problem{errProblem("failed to read actual content", err)}
+			}
+			results := make([][]problem, 0, len(expected))
+			for _, s := range expected {
+				y := *actual
+				y.content = io.NopCloser(bytes.NewReader(content))
+				results = append(results, eqFile(opts, path, s.file(actual), &y))
+			}
+			return combineResults(results)
+		})
+		return nil
+	}
+}
+
+// contentExpectation returns a matcher which compares the content of an
+// actual file to the expected content of f, or nil if f only expects empty
+// content. Empty content is not compared, because it is the placeholder of a
+// file created with WithFile(name, "", ...). The mode and owner are not
+// compared by the matcher, because they are compared with the expectation of f.
+func contentExpectation(f *file) (fileMatcher, error) {
+	template := *f
+	template.resource = resource{mode: anyFileMode, uid: unsetID, gid: unsetID}
+	template.sameFileAs = ""
+	template.extents = nil
+	template.matchers = nil
+	s := scratchFile{template: &template}
+	if f.content != nil && f.content != anyFileContent {
+		content, err := readAll(f.content)
+		if err != nil {
+			return nil, err
+		}
+		s.content = content
+	}
+	hasMatcher := f.compareContentFunc != nil || f.contentFunc != nil || f.readerFunc != nil
+	if len(s.content) == 0 && !hasMatcher {
+		return nil, nil
+	}
+	return func(opts *compareOptions, path string, actual *file) []problem {
+		y := *actual
+		return eqFile(opts, path, s.file(actual), &y)
+	}, nil
+}
+
+// eqMatchers compares actual to the expected content of x, and to every matcher
+// of x. When there is more than one of them the content of actual is read once
+// and is passed to each of them.
+func eqMatchers(opts *compareOptions, path string, x, actual *file) []problem {
+	matchers := x.matchers
+	previous, err := contentExpectation(x)
+	if err != nil {
+		return []problem{errProblem("failed to read expected content", err)}
+	}
+	if previous != nil {
+		matchers = append([]fileMatcher{previous}, matchers...)
+	}
+	if len(matchers) == 1 {
+		if actual.content != nil {
+			defer actual.content.Close()
+		}
+		return matchers[0](opts, path, actual)
+	}
+	content, err := readAll(actual.content)
+	if err != nil {
+		return []problem{errProblem("failed to read actual content", err)}
+	}
+	var p []problem
+	for _, matcher := range matchers {
+		y := *actual
+		y.content = io.NopCloser(bytes.NewReader(content))
+		p = append(p, matcher(opts, path, &y)...)
+	}
+	return p
+}
+
+// scratchFile is the expectation of a single op in a combined matcher. The
+// content is buffered so that it can be compared more than once.
+type scratchFile struct {
+	template *file
+	content  []byte
+}
+
+func newScratchFile(op PathOp) (scratchFile, error) {
+	f := &file{resource: resource{mode: anyFileMode, uid: unsetID, gid: unsetID}}
+	if err := op(&filePath{file: f}); err != nil {
+		return scratchFile{}, err
+	}
+	s := scratchFile{template: f}
+	if f.content != nil && f.content != anyFileContent {
+		content, err := readAll(f.content)
+		if err != nil {
+			return scratchFile{}, err
+		}
+		s.content = content
+	}
+	return s, nil
+}
+
+// file returns a copy of the expectation to compare to actual.
+func (s scratchFile) file(actual *file) *file {
+	x := *s.template
+	if x.uid == unsetID {
+		x.uid = actual.uid
+	}
+	if x.gid == unsetID {
+		x.gid = actual.gid
+	}
+	hasMatcher := x.compareContentFunc != nil || x.contentFunc != nil || x.readerFunc != nil || len(x.matchers) > 0
+	switch {
+	case s.content != nil:
+		x.content = io.NopCloser(bytes.NewReader(s.content))
+	case x.content == nil && hasMatcher:
+		x.content = io.NopCloser(bytes.NewReader(nil))
+	case x.content == nil:
+		x.content = anyFileContent
+	}
+	return &x
+}
+
+func readAll(r io.ReadCloser) ([]byte, error) {
+	if r == nil {
+		return nil, nil
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
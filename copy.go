@@ -0,0 +1,88 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// copyTree copies the contents of the directory source into dest, keeping the
+// mode of every file and directory.
+func copyTree(source, dest string) error {
+	return copyTreeWith(source, dest, func(source, dest string, info os.FileInfo) (bool, error) {
+		if info.Mode()&os.ModeSymlink != 0 {
+			return true, copySymLink(source, dest)
+		}
+		return false, copyFile(source, dest)
+	})
+}
+
+// copyTreeWith copies the contents of the directory source to dest, using
+// copyEntry to copy each file and symlink. copyEntry returns true if the mode of
+// the copy must not be changed, because it is a link.
+func copyTreeWith(source, dest string, copyEntry func(source, dest string, info os.FileInfo) (bool, error)) error {
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		sourcePath := filepath.Join(source, entry.Name())
+		destPath := filepath.Join(dest, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.IsDir():
+			if err := os.Mkdir(destPath, 0700); err != nil {
+				return err
+			}
+			if err := copyTreeWith(sourcePath, destPath, copyEntry); err != nil {
+				return err
+			}
+		default:
+			linked, err := copyEntry(sourcePath, destPath, info)
+			if err != nil {
+				return err
+			}
+			if linked {
+				continue
+			}
+		}
+		if err := os.Chmod(destPath, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyTimes sets the modification time of every file and directory in dest to
+// the modification time of the same file in source. Symlinks are not changed.
+func copyTimes(source, dest string) error {
+	var paths []string
+	err := filepath.WalkDir(source, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && entry.Type()&os.ModeSymlink == 0 {
+			paths = append(paths, path)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// Directories are changed after their contents, because copying the
+	// contents changes the modification time of the directory.
+	for i := len(paths) - 1; i >= 0; i-- {
+		info, err := os.Stat(paths[i])
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, paths[i])
+		if err != nil {
+			return err
+		}
+		if err := os.Chtimes(filepath.Join(dest, rel), time.Time{}, info.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const hexDumpRowSize = 8
+
+// isBinary returns true if content should be shown as a hexdump instead of a
+// text diff.
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content, 0) != -1 || !utf8.Valid(content)
+}
+
+// hexDiff returns side-by-side hexdump excerpts of the first maxRanges ranges of
+// rows which differ between x and y.
+func hexDiff(x, y []byte, maxRanges int) string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "binary content differs, expected %d bytes got %d bytes:\n", len(x), len(y))
+	fmt.Fprintf(buf, "%-8s  %-*s  %s\n", "offset", hexDumpWidth, "expected", "actual")
+
+	rows := (max(len(x), len(y)) + hexDumpRowSize - 1) / hexDumpRowSize
+	ranges := 0
+	inRange := false
+	for row := 0; row < rows; row++ {
+		xRow := hexDumpRow(x, row)
+		yRow := hexDumpRow(y, row)
+		if bytes.Equal(xRow, yRow) && len(xRow) == len(yRow) {
+			inRange = false
+			continue
+		}
+		if !inRange {
+			ranges++
+			inRange = true
+			if ranges > maxRanges {
+				break
+			}
+			if ranges > 1 {
+				buf.WriteString("...\n")
+			}
+		}
+		fmt.Fprintf(buf, "%08x  %s  %s\n", row*hexDumpRowSize, formatHexDumpRow(xRow), formatHexDumpRow(yRow))
+	}
+	if ranges > maxRanges {
+		fmt.Fprintf(buf, "... and more differences not shown\n")
+	}
+	return buf.String()
+}
+
+// hexDumpWidth is the width of a formatted row: hex bytes and ascii.
+const hexDumpWidth = hexDumpRowSize*3 - 1 + 2 + hexDumpRowSize + 2
+
+func hexDumpRow(content []byte, row int) []byte {
+	start := row * hexDumpRowSize
+	if start >= len(content) {
+		return nil
+	}
+	return content[start:min(start+hexDumpRowSize, len(content))]
+}
+
+func formatHexDumpRow(row []byte) string {
+	hex := make([]string, hexDumpRowSize)
+	ascii := new(strings.Builder)
+	for i := range hex {
+		if i >= len(row) {
+			hex[i] = "  "
+			continue
+		}
+		hex[i] = fmt.Sprintf("%02x", row[i])
+		if row[i] >= 0x20 && row[i] < 0x7f {
+			ascii.WriteByte(row[i])
+		} else {
+			ascii.WriteByte('.')
+		}
+	}
+	return fmt.Sprintf("%s  |%-*s|", strings.Join(hex, " "), hexDumpRowSize, ascii.String())
+}
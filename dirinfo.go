@@ -0,0 +1,127 @@
+package fs
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TotalSize returns the total size in bytes of the regular files in the
+// directory and its subdirectories.
+func (d *Dir) TotalSize() (int64, error) {
+	var size int64
+	err := filepath.WalkDir(d.path, func(path string, entry iofs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// FileCount returns the number of files and symlinks in the directory and its
+// subdirectories. Directories are not counted.
+func (d *Dir) FileCount() (int, error) {
+	var count int
+	err := filepath.WalkDir(d.path, func(path string, entry iofs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// Checksum returns the hex encoded checksum, computed with h, of the relative
+// path, type, and content of every entry in the directory, so that two trees
+// can be compared by a single value, for example across processes. The target
+// of a symlink is used instead of its content. The mode, owner, and timestamps
+// of entries are not part of the checksum.
+//
+//	sum, err := dir.Checksum(sha256.New())
+func (d *Dir) Checksum(h hash.Hash) (string, error) {
+	err := filepath.WalkDir(d.path, func(path string, entry iofs.DirEntry, err error) error {
+		if err != nil || path == d.path {
+			return err
+		}
+		rel, err := filepath.Rel(d.path, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case entry.IsDir():
+			fmt.Fprintf(h, "dir %q\n", rel)
+		case entry.Type()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "symlink %q %q\n", rel, target)
+		case entry.Type().IsRegular():
+			return hashFile(h, rel, path)
+		default:
+			fmt.Fprintf(h, "%s %q\n", entry.Type(), rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(h hash.Hash, rel, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(h, "file %q %d\n", rel, info.Size())
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// Walk calls fn for every entry in the directory and its subdirectories, in
+// lexical order, with the path of the entry relative to the directory. The
+// directory itself is not passed to fn. An error returned by fn, or an error
+// reading the directory, fails the test and stops the walk. fn may return
+// [iofs.SkipDir] to skip a directory, or [iofs.SkipAll] to stop the walk
+// without failing the test.
+func (d *Dir) Walk(t *testing.T, fn func(rel string, entry iofs.DirEntry) error) {
+	t.Helper()
+	err := filepath.WalkDir(d.path, func(path string, entry iofs.DirEntry, err error) error {
+		if err != nil || path == d.path {
+			return err
+		}
+		rel, err := filepath.Rel(d.path, path)
+		if err != nil {
+			return err
+		}
+		if err := fn(rel, entry); err != nil {
+			if err == iofs.SkipDir || err == iofs.SkipAll {
+				return err
+			}
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+}
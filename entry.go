@@ -0,0 +1,121 @@
+package fs
+
+import (
+	"io"
+	"os"
+)
+
+// EntryMatcher is an expectation for an entry in a [Manifest] which is compared
+// by code outside of this package, for example an encrypted file which must
+// decrypt to the expected content. Use [WithEntry] to add an EntryMatcher to a
+// manifest.
+type EntryMatcher interface {
+	// Kind describes the expected entry in failure messages, for example
+	// "encrypted file".
+	Kind() string
+	// CompareTo compares the actual entry to the expectation, and returns a
+	// description of each difference. The entry matches if no differences are
+	// returned.
+	CompareTo(actual ActualEntry) []string
+}
+
+// ActualEntry is an entry in the filesystem which is compared to an
+// [EntryMatcher].
+type ActualEntry interface {
+	// Path is the slash separated path of the entry relative to the root of
+	// the comparison.
+	Path() string
+	// Type is the type of the entry, one of "file", "directory", or "symlink".
+	Type() string
+	Mode() os.FileMode
+	UID() uint32
+	GID() uint32
+	// Content returns the content of a file, which may only be read once. It
+	// returns nil for other types of entries.
+	Content() io.Reader
+	// Target returns the target of a symlink, or an empty string for other
+	// types of entries.
+	Target() string
+}
+
+// WithEntry is a [PathOp] that updates a [Manifest] so that the entry name in
+// the directory at path is compared by matcher.
+func WithEntry(name string, matcher EntryMatcher) PathOp {
+	return func(path Path) error {
+		if m, ok := path.(*directoryPath); ok {
+			m.directory.items[name] = &customEntry{matcher: matcher}
+		}
+		return nil
+	}
+}
+
+// customEntry is an entry which is compared by an EntryMatcher.
+type customEntry struct {
+	matcher EntryMatcher
+}
+
+func (c *customEntry) Type() string {
+	return c.matcher.Kind()
+}
+
+func eqCustomEntry(path string, x *customEntry, y dirEntry) []problem {
+	if f, ok := y.(*file); ok && f.content != nil {
+		defer f.content.Close()
+	}
+	var p []problem
+	for _, message := range x.matcher.CompareTo(&actualEntry{path: path, entry: y}) {
+		p = append(p, problem{kind: MismatchCustom, message: message})
+	}
+	return p
+}
+
+type actualEntry struct {
+	path  string
+	entry dirEntry
+}
+
+func (e *actualEntry) Path() string {
+	return relativePath(e.path)
+}
+
+func (e *actualEntry) Type() string {
+	return e.entry.Type()
+}
+
+func (e *actualEntry) resource() resource {
+	switch typed := e.entry.(type) {
+	case *file:
+		return typed.resource
+	case *directory:
+		return typed.resource
+	case *symlink:
+		return typed.resource
+	}
+	return resource{}
+}
+
+func (e *actualEntry) Mode() os.FileMode {
+	return e.resource().mode
+}
+
+func (e *actualEntry) UID() uint32 {
+	return e.resource().uid
+}
+
+func (e *actualEntry) GID() uint32 {
+	return e.resource().gid
+}
+
+func (e *actualEntry) Content() io.Reader {
+	if f, ok := e.entry.(*file); ok && f.content != nil {
+		return f.content
+	}
+	return nil
+}
+
+func (e *actualEntry) Target() string {
+	if s, ok := e.entry.(*symlink); ok {
+		return s.target
+	}
+	return ""
+}
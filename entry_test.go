@@ -0,0 +1,60 @@
+package fs
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// base64File is an EntryMatcher for a file which contains base64 encoded
+// content.
+type base64File struct {
+	content string
+}
+
+func (b base64File) Kind() string {
+	return "base64 file"
+}
+
+func (b base64File) CompareTo(actual ActualEntry) []string {
+	if actual.Type() != "file" {
+		return []string{fmt.Sprintf("%s: expected file got %s", actual.Path(), actual.Type())}
+	}
+	decoded, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, actual.Content()))
+	if err != nil {
+		return []string{fmt.Sprintf("failed to decode %s: %s", actual.Path(), err)}
+	}
+	if string(decoded) != b.content {
+		return []string{fmt.Sprintf("decoded content: expected %q got %q", b.content, decoded)}
+	}
+	return nil
+}
+
+func TestEqualWithEntry(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("secret", base64.StdEncoding.EncodeToString([]byte("password"))),
+		WithDir("sub"))
+	defer dir.Remove()
+
+	manifest := Expected(t,
+		WithEntry("secret", base64File{content: "password"}),
+		WithDir("sub"))
+	assert.Assert(t, Equal(t, dir.Path(), manifest))
+
+	manifest = Expected(t,
+		WithEntry("secret", base64File{content: "other"}),
+		WithEntry("sub", base64File{}),
+		WithEntry("missing", base64File{}))
+	result := Compare(dir.Path(), manifest)
+	assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/
+  missing: expected base64 file to exist
+/secret
+  decoded content: expected "other" got "password"
+/sub
+  sub: expected file got directory
+`, dir.Path()))
+}
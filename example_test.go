@@ -4,9 +4,9 @@ import (
 	"os"
 	"testing"
 
+	fs "github.com/goslogan/assertfs"
 	"gotest.tools/v3/assert"
 	"gotest.tools/v3/assert/cmp"
-	"gotest.tools/v3/fs"
 	"gotest.tools/v3/golden"
 )
 
@@ -53,7 +53,7 @@ func ExampleEqual() {
 		fs.WithDir("data",
 			fs.WithFile("config", "", fs.MatchAnyFileContent)))
 
-	assert.Assert(t, fs.Equal(path, expected))
+	assert.Assert(t, fs.Equal(t, path, expected))
 }
 
 func operationWhichCreatesFiles() string {
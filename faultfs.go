@@ -0,0 +1,182 @@
+package fs
+
+import (
+	"io"
+	iofs "io/fs"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Fault configures the errors and delays injected by [NewFaultFS].
+type Fault func(*faultFS)
+
+// FailNthRead is a [Fault] which makes the nth call to Read, counting from 1
+// across every file opened from the filesystem, return err.
+func FailNthRead(n int, err error) Fault {
+	return func(f *faultFS) {
+		f.readFaults[n] = err
+	}
+}
+
+// FailPaths is a [Fault] which makes Open and Stat return err for every path which
+// matches pattern. The pattern uses the syntax of [path.Match], and may use **
+// to match any number of directories. Use [io/fs.ErrPermission] as err to test
+// the handling of files which can not be read.
+func FailPaths(pattern string, err error) Fault {
+	return func(f *faultFS) {
+		f.pathFaults = append(f.pathFaults, pathFault{pattern: pattern, err: err})
+	}
+}
+
+// ShortReads is a [Fault] which makes every call to Read return at most n
+// bytes.
+func ShortReads(n int) Fault {
+	return func(f *faultFS) {
+		f.maxRead = n
+	}
+}
+
+// ShortWrites is a [Fault] which makes every call to Write on a file that
+// supports writing write at most n bytes, and return [io.ErrShortWrite].
+func ShortWrites(n int) Fault {
+	return func(f *faultFS) {
+		f.maxWrite = n
+	}
+}
+
+// WithLatency is a [Fault] which delays every call to Open, Read and Stat by a
+// random duration between min and max, so that timeouts and the concurrency of
+// code which scans a directory can be tested. Use the same min and max for a
+// fixed delay.
+func WithLatency(min, max time.Duration) Fault {
+	return func(f *faultFS) {
+		f.minLatency = min
+		f.maxLatency = max
+	}
+}
+
+type pathFault struct {
+	pattern string
+	err     error
+}
+
+type faultFS struct {
+	fsys       iofs.FS
+	readFaults map[int]error
+	pathFaults []pathFault
+	maxRead    int
+	maxWrite   int
+	minLatency time.Duration
+	maxLatency time.Duration
+
+	mu    sync.Mutex
+	reads int
+}
+
+// NewFaultFS returns an [io/fs.FS] which reads from fsys, such as the FS of a
+// [Dir], and injects the errors and delays configured by faults, so that
+// retries and error handling can be tested deterministically.
+//
+//	fsys := fs.NewFaultFS(dir.FS(),
+//		fs.FailPaths("secret/**", iofs.ErrPermission),
+//		fs.FailNthRead(3, io.ErrUnexpectedEOF))
+func NewFaultFS(fsys iofs.FS, faults ...Fault) iofs.FS {
+	f := &faultFS{fsys: fsys, readFaults: make(map[int]error)}
+	for _, fault := range faults {
+		fault(f)
+	}
+	return f
+}
+
+func (f *faultFS) Open(name string) (iofs.File, error) {
+	f.delay()
+	if err := f.pathFault("open", name); err != nil {
+		return nil, err
+	}
+	file, err := f.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: file, fsys: f, name: name}, nil
+}
+
+func (f *faultFS) Stat(name string) (iofs.FileInfo, error) {
+	f.delay()
+	if err := f.pathFault("stat", name); err != nil {
+		return nil, err
+	}
+	return iofs.Stat(f.fsys, name)
+}
+
+func (f *faultFS) pathFault(op, name string) error {
+	for _, fault := range f.pathFaults {
+		if matchDoublestar(fault.pattern, name) {
+			return &iofs.PathError{Op: op, Path: name, Err: fault.err}
+		}
+	}
+	return nil
+}
+
+func (f *faultFS) delay() {
+	d := f.minLatency
+	if f.maxLatency > f.minLatency {
+		d += time.Duration(rand.Int63n(int64(f.maxLatency - f.minLatency)))
+	}
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// readFault returns the error injected into the next call to Read.
+func (f *faultFS) readFault() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reads++
+	return f.readFaults[f.reads]
+}
+
+type faultFile struct {
+	iofs.File
+	fsys *faultFS
+	name string
+}
+
+func (f *faultFile) Read(b []byte) (int, error) {
+	f.fsys.delay()
+	if err := f.fsys.readFault(); err != nil {
+		return 0, err
+	}
+	if f.fsys.maxRead > 0 && len(b) > f.fsys.maxRead {
+		b = b[:f.fsys.maxRead]
+	}
+	return f.File.Read(b)
+}
+
+func (f *faultFile) Stat() (iofs.FileInfo, error) {
+	f.fsys.delay()
+	return f.File.Stat()
+}
+
+func (f *faultFile) Write(b []byte) (int, error) {
+	w, ok := f.File.(io.Writer)
+	if !ok {
+		return 0, &iofs.PathError{Op: "write", Path: f.name, Err: iofs.ErrInvalid}
+	}
+	if f.fsys.maxWrite > 0 && len(b) > f.fsys.maxWrite {
+		n, err := w.Write(b[:f.fsys.maxWrite])
+		if err == nil {
+			err = io.ErrShortWrite
+		}
+		return n, err
+	}
+	return w.Write(b)
+}
+
+func (f *faultFile) ReadDir(n int) ([]iofs.DirEntry, error) {
+	dir, ok := f.File.(iofs.ReadDirFile)
+	if !ok {
+		return nil, &iofs.PathError{Op: "readdir", Path: f.name, Err: iofs.ErrInvalid}
+	}
+	return dir.ReadDir(n)
+}
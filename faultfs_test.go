@@ -0,0 +1,57 @@
+package fs_test
+
+import (
+	"errors"
+	"io"
+	iofs "io/fs"
+	"testing"
+	"time"
+
+	fs "github.com/goslogan/assertfs"
+	"gotest.tools/v3/assert"
+)
+
+func TestNewFaultFS(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithFile("file1", "content"),
+		fs.WithDir("secret", fs.WithDir("nested", fs.WithFile("file2", "content"))))
+
+	fsys := fs.NewFaultFS(dir.FS(), fs.FailPaths("secret/**", iofs.ErrPermission))
+	_, err := iofs.ReadFile(fsys, "secret/nested/file2")
+	assert.ErrorIs(t, err, iofs.ErrPermission)
+	content, err := iofs.ReadFile(fsys, "file1")
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "content")
+	entries, err := iofs.ReadDir(fsys, ".")
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 2)
+
+	errRead := errors.New("injected")
+	fsys = fs.NewFaultFS(dir.FS(), fs.FailNthRead(2, errRead), fs.ShortReads(3))
+	f, err := fsys.Open("file1")
+	assert.NilError(t, err)
+	defer f.Close()
+	buf := make([]byte, 10)
+	n, err := f.Read(buf)
+	assert.NilError(t, err)
+	assert.Equal(t, string(buf[:n]), "con")
+	_, err = f.Read(buf)
+	assert.ErrorIs(t, err, errRead)
+	rest, err := io.ReadAll(f)
+	assert.NilError(t, err)
+	assert.Equal(t, string(rest), "tent")
+}
+
+func TestNewFaultFSWithLatency(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(), fs.WithFile("file1", "content"))
+
+	fsys := fs.NewFaultFS(dir.FS(), fs.WithLatency(5*time.Millisecond, 10*time.Millisecond))
+	start := time.Now()
+	_, err := iofs.Stat(fsys, "file1")
+	assert.NilError(t, err)
+	content, err := iofs.ReadFile(fsys, "file1")
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "content")
+	// Stat, then Open, Stat and at least one Read.
+	assert.Assert(t, time.Since(start) >= 20*time.Millisecond)
+}
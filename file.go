@@ -5,11 +5,16 @@ contents and structure of a directory.
 package fs // import "gotest.tools/v3/fs"
 
 import (
+	"context"
+	iofs "io/fs"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -30,6 +35,10 @@ var (
 // File is a temporary file on the filesystem
 type File struct {
 	path string
+	// cleanupPolicy decides if the file is kept when the test ends.
+	cleanupPolicy CleanupPolicy
+	// apply is the state used while PathOps are applied.
+	apply *applyState
 }
 
 type helperT interface {
@@ -40,16 +49,42 @@ type helperT interface {
 // the filename. The PathOps are applied to the before returning the File.
 //
 // When used with Go 1.14+ the file will be automatically removed when the test
-// ends, unless the TEST_NOCLEANUP env var is set to true.
+// ends, unless the TEST_NOCLEANUP env var is set to true. Use [KeepOnFailure] to
+// keep the file when the test fails, or see [WithCleanupPolicy] for other ways
+// to keep it.
 func NewFile(t *testing.T, prefix string, ops ...PathOp) *File {
 	tempfile, err := os.CreateTemp("", cleanPrefix(prefix)+"-")
 	assert.Nil(t, err)
 
 	file := &File{path: tempfile.Name()}
-	t.Cleanup(file.Remove)
+	register(file.path)
+	removeOnCleanup(t, file, file.RemoveE)
 
 	assert.Nil(t, tempfile.Close())
-	assert.Nil(t, applyPathOps(file, ops))
+	assert.Nil(t, applyToNew(file, newApplyState(context.Background(), t), ops))
+	return file
+}
+
+// NewNamedFile creates a new file named name in the directory dir. Unlike
+// [NewFile] no random suffix is added to the name, so it can be used when the
+// code under test requires an exact filename. The test fails if the file
+// already exists. The PathOps are applied before returning the File, and the
+// file is removed when the test ends, like a File created by NewFile.
+func NewNamedFile(t *testing.T, dir, name string, ops ...PathOp) *File {
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if !assert.Nil(t, err) {
+		// Stop before the PathOps modify, or the cleanup removes, a file which
+		// was not created by the test.
+		t.FailNow()
+	}
+
+	file := &File{path: path}
+	register(file.path)
+	removeOnCleanup(t, file, file.RemoveE)
+
+	assert.Nil(t, f.Close())
+	assert.Nil(t, applyToNew(file, newApplyState(context.Background(), t), ops))
 	return file
 }
 
@@ -66,28 +101,101 @@ func (f *File) Path() string {
 	return f.path
 }
 
-// Remove the file
+// Remove the file. A read-only file is made writable before it is removed,
+// because read-only files can not be removed on Windows. Use [File.RemoveE] to
+// handle the error if the file can not be removed.
 func (f *File) Remove() {
-	_ = os.Remove(f.path)
+	_ = f.RemoveE()
+}
+
+// RemoveE removes the file like [File.Remove], and returns an error if the file
+// exists and can not be removed.
+func (f *File) RemoveE() error {
+	remove := func() error {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		unregister(f.path)
+		return nil
+	}
+	if retryRemove(remove) == nil {
+		return nil
+	}
+	_ = os.Chmod(f.path, 0600)
+	return retryRemove(remove)
+}
+
+// Bytes returns the content of the file. The test fails if the file can not be
+// read.
+func (f *File) Bytes(t *testing.T) []byte {
+	t.Helper()
+	content, err := os.ReadFile(f.path)
+	assert.Nil(t, err)
+	return content
+}
+
+// String returns the content of the file as a string. The test fails if the
+// file can not be read.
+func (f *File) String(t *testing.T) string {
+	t.Helper()
+	return string(f.Bytes(t))
+}
+
+// Write replaces the content of the file with data. The mode of the file is not
+// changed. The test fails if the file can not be written.
+func (f *File) Write(t *testing.T, data []byte) {
+	t.Helper()
+	f.write(t, data, os.O_TRUNC)
+}
+
+// Append adds data to the end of the file, so that a test can simulate a file
+// which is written incrementally, such as a log. The test fails if the file can
+// not be written.
+func (f *File) Append(t *testing.T, data []byte) {
+	t.Helper()
+	f.write(t, data, os.O_APPEND)
+}
+
+func (f *File) write(t *testing.T, data []byte, flag int) {
+	t.Helper()
+	file, err := os.OpenFile(f.path, os.O_WRONLY|flag, 0)
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, err = file.Write(data)
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
 }
 
 // Dir is a temporary directory
 type Dir struct {
 	path string
+	// modes are the modes of the entries changed by MakeReadOnly, which are
+	// restored by MakeWritable.
+	modes map[string]os.FileMode
+	// readOnlyMount is true if MakeReadOnly remounted the directory.
+	readOnlyMount bool
+	// cleanupPolicy decides if the directory is kept when the test ends.
+	cleanupPolicy CleanupPolicy
+	// apply is the state used while PathOps are applied.
+	apply *applyState
 }
 
 // NewDir returns a new temporary directory using prefix as part of the directory
 // name. The PathOps are applied before returning the Dir.
 //
 // When used with Go 1.14+ the directory will be automatically removed when the test
-// ends, unless the TEST_NOCLEANUP env var is set to true.
+// ends, unless the TEST_NOCLEANUP env var is set to true. Use [KeepOnFailure] to
+// keep the directory when the test fails, or see [WithCleanupPolicy] for other
+// ways to keep it.
 func NewDir(t *testing.T, prefix string, ops ...PathOp) *Dir {
 	path, err := os.MkdirTemp("", cleanPrefix(prefix)+"-")
 	assert.Nil(t, err)
 	dir := &Dir{path: path}
-	t.Cleanup(dir.Remove)
+	register(path)
+	removeOnCleanup(t, dir, dir.RemoveE)
 
-	assert.Nil(t, applyPathOps(dir, ops))
+	assert.Nil(t, applyToNew(dir, newApplyState(context.Background(), t), ops))
 	return dir
 }
 
@@ -96,9 +204,128 @@ func (d *Dir) Path() string {
 	return d.path
 }
 
-// Remove the directory
+// Remove the directory. If the directory was made read-only by
+// [Dir.MakeReadOnly] it is made writable before it is removed. If the directory
+// contains read-only files, or directories which can not be read or written,
+// such as those created with [WithNoAccess], their permissions are restored so
+// that they can be removed. Use [Dir.RemoveE] to handle the error if the
+// directory can not be removed.
 func (d *Dir) Remove() {
-	_ = os.RemoveAll(d.path)
+	_ = d.RemoveE()
+}
+
+// RemoveE removes the directory like [Dir.Remove], and returns an error if the
+// directory can not be removed.
+func (d *Dir) RemoveE() error {
+	_ = d.MakeWritable()
+	remove := func() error {
+		err := os.RemoveAll(d.path)
+		if err == nil {
+			unregister(d.path)
+		}
+		return err
+	}
+	if retryRemove(remove) == nil {
+		return nil
+	}
+	restorePermissions(d.path)
+	return retryRemove(remove)
+}
+
+const removeAttempts = 6
+
+// retryRemove calls remove until it succeeds, retrying with an increasing delay
+// while it fails because a file is in use. On Windows files which are open, for
+// example by a virus scanner, can not be removed until they are closed.
+func retryRemove(remove func() error) error {
+	delay := 10 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := remove()
+		if err == nil || attempt == removeAttempts || !isSharingViolation(err) {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// restorePermissions gives the owner full access to every directory in root
+// which can not be read, written or searched, and makes read-only files
+// writable, so that root can be removed. Making files writable clears the
+// read-only attribute on Windows, which otherwise prevents them from being
+// removed. Files with more than one link, such as those shared with a cached
+// fixture, are not changed, because their mode is shared by every link.
+func restorePermissions(root string) {
+	_ = filepath.WalkDir(root, func(path string, entry iofs.DirEntry, err error) error {
+		if err != nil || !(entry.IsDir() || entry.Type().IsRegular()) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		mode := info.Mode().Perm()
+		switch {
+		case entry.IsDir() && mode&0700 != 0700:
+			_ = os.Chmod(path, mode|0700)
+		case !entry.IsDir() && mode&0200 == 0 && linkCount(info) <= 1:
+			_ = os.Chmod(path, mode|0200)
+		}
+		return nil
+	})
+}
+
+// MakeReadOnly makes the directory and everything in it read-only, so that the
+// handling of write failures can be tested. When run by root on Linux the
+// directory is remounted read-only, and writes fail with EROFS. Otherwise the
+// write permission is removed from every entry, and writes fail with EACCES.
+// The directory is made writable again by [Dir.MakeWritable], or when it is
+// removed.
+func (d *Dir) MakeReadOnly() error {
+	if d.readOnlyMount || d.modes != nil {
+		return nil
+	}
+	if os.Geteuid() == 0 && remountReadOnly(d.path) == nil {
+		d.readOnlyMount = true
+		return nil
+	}
+
+	modes := make(map[string]os.FileMode)
+	err := filepath.Walk(d.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			return err
+		}
+		modes[path] = info.Mode().Perm()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	d.modes = modes
+	for path, mode := range modes {
+		if err := os.Chmod(path, mode&^0222); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MakeWritable restores the directory after [Dir.MakeReadOnly]. It does nothing
+// if the directory is not read-only.
+func (d *Dir) MakeWritable() error {
+	if d.readOnlyMount {
+		if err := unmountReadOnly(d.path); err != nil {
+			return err
+		}
+		d.readOnlyMount = false
+	}
+	for path, mode := range d.modes {
+		if err := os.Chmod(path, mode); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	d.modes = nil
+	return nil
 }
 
 // Join returns a new path with this directory as the base of the path
@@ -106,6 +333,113 @@ func (d *Dir) Join(parts ...string) string {
 	return filepath.Join(append([]string{d.Path()}, parts...)...)
 }
 
+// NewFile creates a new file named name in the directory, and applies the
+// PathOps to it. name may be a relative path, and missing parent directories
+// are created. The test fails if the file already exists. The file is not
+// removed when the test ends, it is removed with the directory.
+func (d *Dir) NewFile(t *testing.T, name string, ops ...PathOp) *File {
+	path := d.Join(name)
+	assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.Nil(t, f.Close())
+
+	file := &File{path: path}
+	assert.Nil(t, applyToNew(file, newApplyState(context.Background(), t), ops))
+	return file
+}
+
+// Sub returns a Dir for the subdirectory at the relative path name, so that
+// functions which accept a Dir can be used with part of the directory. The
+// subdirectory is not created if it does not exist, and it is not removed when
+// the test ends, it is removed with the directory.
+func (d *Dir) Sub(name string) *Dir {
+	return &Dir{path: d.Join(name)}
+}
+
+// CopyTo copies the directory and everything in it to dest, keeping the mode
+// and modification time of every file and directory. Symlinks are copied with
+// the same target. dest is created, and must not already exist. Unlike the Dir,
+// the copy is not removed when the test ends.
+func (d *Dir) CopyTo(dest string) error {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return err
+	}
+	if err := os.Mkdir(dest, 0700); err != nil {
+		return err
+	}
+	if err := copyTree(d.path, dest); err != nil {
+		return err
+	}
+	if err := os.Chmod(dest, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return copyTimes(d.path, dest)
+}
+
+// MoveTo moves the directory to dest, which must not already exist, and
+// changes the path of the Dir to dest, so that it is still removed when the
+// test ends. The directory is renamed if possible. If it can not be renamed
+// because dest is on a different filesystem, it is copied with [Dir.CopyTo]
+// and then removed. If the copy fails, the partial copy is removed.
+func (d *Dir) MoveTo(dest string) error {
+	if _, err := os.Lstat(dest); err == nil {
+		return &os.LinkError{Op: "rename", Old: d.path, New: dest, Err: os.ErrExist}
+	}
+	if err := os.Rename(d.path, dest); err != nil {
+		if !isCrossDevice(err) {
+			return err
+		}
+		if err := d.CopyTo(dest); err != nil {
+			_ = (&Dir{path: dest}).RemoveE()
+			return err
+		}
+		if err := d.RemoveE(); err != nil {
+			return err
+		}
+	}
+	register(dest)
+	unregister(d.path)
+	d.path = dest
+	return nil
+}
+
+// WriteFile writes content to the file at the relative path name in the
+// directory, creating missing parent directories. If the file does not exist
+// it is created with mode, otherwise it is truncated. The test fails if the
+// file can not be written.
+func (d *Dir) WriteFile(t *testing.T, name string, content []byte, mode os.FileMode) {
+	t.Helper()
+	path := d.Join(name)
+	assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.Nil(t, os.WriteFile(path, content, mode))
+}
+
+// ReadFile returns the content of the file at the relative path name in the
+// directory. The test fails if the file can not be read.
+func (d *Dir) ReadFile(t *testing.T, name string) []byte {
+	t.Helper()
+	content, err := os.ReadFile(d.Join(name))
+	assert.Nil(t, err)
+	return content
+}
+
+// FS returns an [iofs.FS] for the files in the directory
+func (d *Dir) FS() iofs.FS {
+	return os.DirFS(d.path)
+}
+
+// NewServer starts an [httptest.Server] which serves the files in the directory
+// using [http.FileServer]. The server is closed when the test ends.
+func (d *Dir) NewServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.FileServer(http.FS(d.FS())))
+	t.Cleanup(server.Close)
+	return server
+}
+
 // DirFromPath returns a Dir for a path that already exists. No directory is created.
 // Unlike NewDir the directory will not be removed automatically when the test exits,
 // it is the callers responsibly to remove the directory.
@@ -115,6 +449,6 @@ func (d *Dir) Join(parts ...string) string {
 func DirFromPath(t *testing.T, path string, ops ...PathOp) *Dir {
 
 	dir := &Dir{path: path}
-	assert.Nil(t, applyPathOps(dir, ops))
+	assert.Nil(t, applyToNew(dir, newApplyState(context.Background(), t), ops))
 	return dir
 }
@@ -1,18 +1,26 @@
 package fs_test
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"io"
+	iofs "io/fs"
+	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
-	"gotest.tools/v3/fs"
+	fs "github.com/goslogan/assertfs"
 )
 
 func TestNewDirWithOpsAndManifestEqual(t *testing.T) {
@@ -43,14 +51,14 @@ func TestNewDirWithOpsAndManifestEqual(t *testing.T) {
 		fs.WithSymlink("link1", dir.Join("file1")),
 		ops[4],
 	)
-	assert.Assert(t, fs.Equal(dir.Path(), fs.Expected(t, manifestOps...)))
+	fs.Equal(t, dir.Path(), fs.Expected(t, manifestOps...))
 }
 
 func TestNewFile(t *testing.T) {
 	t.Run("with test name", func(t *testing.T) {
 		tmpFile := fs.NewFile(t, t.Name())
 		_, err := os.Stat(tmpFile.Path())
-		assert.NilError(t, err)
+		assert.NoError(t, err)
 
 		tmpFile.Remove()
 		_, err = os.Stat(tmpFile.Path())
@@ -60,7 +68,7 @@ func TestNewFile(t *testing.T) {
 	t.Run(`with \ in name`, func(t *testing.T) {
 		tmpFile := fs.NewFile(t, `foo\thing`)
 		_, err := os.Stat(tmpFile.Path())
-		assert.NilError(t, err)
+		assert.NoError(t, err)
 
 		tmpFile.Remove()
 		_, err = os.Stat(tmpFile.Path())
@@ -68,9 +76,181 @@ func TestNewFile(t *testing.T) {
 	})
 }
 
+func TestFileBytesAndString(t *testing.T) {
+	file := fs.NewFile(t, t.Name(), fs.WithContent("content"))
+	assert.Equal(t, file.Bytes(t), []byte("content"))
+	assert.Equal(t, file.String(t), "content")
+}
+
+func TestFileWriteAndAppend(t *testing.T) {
+	file := fs.NewFile(t, t.Name(), fs.WithContent("content"), fs.WithMode(0640))
+	file.Write(t, []byte("line1\n"))
+	assert.Equal(t, file.String(t), "line1\n")
+	file.Append(t, []byte("line2\n"))
+	file.Append(t, []byte("line3\n"))
+	assert.Equal(t, file.String(t), "line1\nline2\nline3\n")
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(file.Path())
+		assert.NoError(t, err)
+		assert.Equal(t, info.Mode().Perm(), os.FileMode(0640))
+	}
+}
+
+func TestNewNamedFile(t *testing.T) {
+	dir := fs.NewDir(t, t.Name())
+	file := fs.NewNamedFile(t, dir.Path(), "config.yaml", fs.WithContent("key: value"))
+	assert.Equal(t, file.Path(), dir.Join("config.yaml"))
+	content, err := os.ReadFile(file.Path())
+	assert.NoError(t, err)
+	assert.Equal(t, string(content), "key: value")
+
+	file.Remove()
+	_, err = os.Stat(file.Path())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDirNewFile(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(), fs.WithFile("file1", "content"))
+	file := dir.NewFile(t, "sub/file2", fs.WithContent("more"), fs.WithMode(0600))
+	assert.Equal(t, file.Path(), dir.Join("sub", "file2"))
+	fs.Equal(t, dir.Path(), fs.Expected(t,
+		fs.MatchAnyFileMode,
+		fs.WithFile("file1", "content"),
+		fs.WithDir("sub",
+			fs.WithFile("file2", "more", fs.WithMode(0600)))))
+
+	dir.Remove()
+	_, err := os.Stat(file.Path())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDirSub(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithDir("a", fs.WithDir("b", fs.WithFile("file1", "content"))))
+	sub := dir.Sub("a/b")
+	assert.Equal(t, sub.Path(), dir.Join("a", "b"))
+	fs.Apply(t, sub, fs.WithFile("file2", "more"))
+	fs.Equal(t, dir.Join("a", "b"), fs.Expected(t,
+		fs.MatchAnyFileMode,
+		fs.WithFile("file1", "content"),
+		fs.WithFile("file2", "more")))
+}
+
+func TestDirWriteFileAndReadFile(t *testing.T) {
+	dir := fs.NewDir(t, t.Name())
+	dir.WriteFile(t, "a/b/file1", []byte("content"), 0600)
+	assert.Equal(t, string(dir.ReadFile(t, "a/b/file1")), "content")
+	fs.Equal(t, dir.Path(), fs.Expected(t,
+		fs.MatchAnyFileMode,
+		fs.WithDir("a", fs.WithDir("b",
+			fs.WithFile("file1", "content", fs.WithMode(0600))))))
+
+	dir.WriteFile(t, "a/b/file1", []byte("new"), 0600)
+	assert.Equal(t, string(dir.ReadFile(t, "a/b/file1")), "new")
+}
+
+func TestDirAccounting(t *testing.T) {
+	ops := []fs.PathOp{
+		fs.WithFile("file1", "content"),
+		fs.WithDir("sub",
+			fs.WithFile("file2", "more content"),
+			fs.WithDir("empty")),
+		fs.WithSymlink("link", "file1"),
+	}
+	dir := fs.NewDir(t, t.Name(), ops...)
+
+	size, err := dir.TotalSize()
+	assert.NoError(t, err)
+	assert.Equal(t, size, int64(len("content")+len("more content")))
+	count, err := dir.FileCount()
+	assert.NoError(t, err)
+	assert.Equal(t, count, 3)
+
+	sum, err := dir.Checksum(sha256.New())
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.Chmod(dir.Join("file1"), 0600))
+	unchangedSum, err := dir.Checksum(sha256.New())
+	assert.NoError(t, err)
+	assert.Equal(t, unchangedSum, sum)
+
+	copied := fs.NewDir(t, t.Name(), fs.FromDir(dir.Path()))
+	copiedSum, err := copied.Checksum(sha256.New())
+	assert.NoError(t, err)
+	assert.Equal(t, copiedSum, sum)
+
+	dir.WriteFile(t, "sub/file2", []byte("changed"), 0644)
+	changedSum, err := dir.Checksum(sha256.New())
+	assert.NoError(t, err)
+	assert.True(t, changedSum != sum)
+}
+
+func TestDirWalk(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithFile("file1", "content"),
+		fs.WithDir("skip", fs.WithFile("file2", "")),
+		fs.WithDir("sub", fs.WithFile("file3", "")))
+
+	var visited []string
+	dir.Walk(t, func(rel string, entry iofs.DirEntry) error {
+		visited = append(visited, filepath.ToSlash(rel))
+		if entry.IsDir() && entry.Name() == "skip" {
+			return iofs.SkipDir
+		}
+		return nil
+	})
+	assert.Equal(t, visited, []string{"file1", "skip", "sub", "sub/file3"})
+}
+
+func TestDirCopyToAndMoveTo(t *testing.T) {
+	modified := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	ops := []fs.PathOp{
+		fs.WithFile("file1", "content", fs.WithMode(0600), fs.WithTimestamps(modified, modified)),
+		fs.WithDir("sub", fs.WithMode(0750),
+			fs.WithFile("file2", "more", fs.WithTimestamps(modified, modified)),
+			fs.WithTimestamps(modified, modified)),
+		fs.WithTimestamps(modified, modified),
+	}
+	dir := fs.NewDir(t, t.Name(), ops...)
+	base := fs.NewDir(t, t.Name())
+	expected := func() fs.Manifest {
+		return fs.Expected(t, fs.MatchAnyFileMode,
+			fs.WithFile("file1", "content", fs.WithMode(0600)),
+			fs.WithDir("sub", fs.WithMode(0750),
+				fs.WithFile("file2", "more")))
+	}
+
+	copied := base.Join("copy")
+	assert.NoError(t, dir.CopyTo(copied))
+	fs.Equal(t, copied, expected())
+	for _, name := range []string{"", "file1", "sub", filepath.Join("sub", "file2")} {
+		info, err := os.Stat(filepath.Join(copied, name))
+		assert.NoError(t, err)
+		assert.True(t, info.ModTime().Equal(modified), name)
+	}
+	assert.ErrorIs(t, dir.CopyTo(copied), os.ErrExist)
+
+	original := dir.Path()
+	moved := base.Join("moved")
+	assert.NoError(t, dir.MoveTo(moved))
+	assert.Equal(t, dir.Path(), moved)
+	fs.Equal(t, moved, expected())
+	_, err := os.Stat(original)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.ErrorIs(t, dir.MoveTo(copied), os.ErrExist)
+
+	// A rename which fails for another reason than a different filesystem is
+	// not retried with a copy.
+	assert.ErrorIs(t, dir.MoveTo(base.Join("missing", "moved")), os.ErrNotExist)
+	assert.Equal(t, dir.Path(), moved)
+	_, err = os.Stat(base.Join("missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
 func TestNewFile_IntegrationWithCleanup(t *testing.T) {
 	major, minor, err := GoVersion()
-	assert.NilError(t, err)
+	assert.NoError(t, err)
 
 	if major < 1 || (major == 1 && minor < 14) {
 		t.Skip("skipping test because Go version is less than 1.14")
@@ -80,7 +260,7 @@ func TestNewFile_IntegrationWithCleanup(t *testing.T) {
 	t.Run("cleanup in subtest", func(t *testing.T) {
 		tmpFile = fs.NewFile(t, t.Name())
 		_, err := os.Stat(tmpFile.Path())
-		assert.NilError(t, err)
+		assert.NoError(t, err)
 	})
 
 	t.Run("file has been removed", func(t *testing.T) {
@@ -92,7 +272,7 @@ func TestNewFile_IntegrationWithCleanup(t *testing.T) {
 func TestNewDir_IntegrationWithCleanup(t *testing.T) {
 
 	major, minor, err := GoVersion()
-	assert.NilError(t, err)
+	assert.NoError(t, err)
 
 	if major < 1 || (major == 1 && minor < 14) {
 		t.Skip("skipping test because Go version is less than 1.14")
@@ -102,7 +282,7 @@ func TestNewDir_IntegrationWithCleanup(t *testing.T) {
 	t.Run("cleanup in subtest", func(t *testing.T) {
 		tmpFile = fs.NewDir(t, t.Name())
 		_, err := os.Stat(tmpFile.Path())
-		assert.NilError(t, err)
+		assert.NoError(t, err)
 	})
 
 	t.Run("dir has been removed", func(t *testing.T) {
@@ -117,7 +297,7 @@ func TestDirFromPath(t *testing.T) {
 	dir := fs.DirFromPath(t, tmpdir, fs.WithFile("newfile", ""))
 
 	_, err := os.Stat(dir.Join("newfile"))
-	assert.NilError(t, err)
+	assert.NoError(t, err)
 
 	assert.Equal(t, dir.Path(), tmpdir)
 	assert.Equal(t, dir.Join("newfile"), filepath.Join(tmpdir, "newfile"))
@@ -125,7 +305,23 @@ func TestDirFromPath(t *testing.T) {
 	dir.Remove()
 
 	_, err = os.Stat(tmpdir)
-	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestDirNewServer(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithDir("static",
+			fs.WithFile("index.txt", "hello\n")))
+
+	server := dir.NewServer(t)
+	resp, err := http.Get(server.URL + "/static/index.txt")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, string(body), "hello\n")
 }
 
 // Returns the go version as major, minor
@@ -150,3 +346,227 @@ func GoVersion() (int, int, error) {
 		return int(rMajor), int(rMinor), nil
 	}
 }
+
+func TestOnTmpfs(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(), fs.OnTmpfs(), fs.WithFile("file1", "content"))
+	file := fs.NewFile(t, t.Name(), fs.OnTmpfs(), fs.WithContent("content"))
+	content, err := os.ReadFile(file.Path())
+	assert.NoError(t, err)
+	assert.Equal(t, string(content), "content")
+	fs.Equal(t, dir.Path(), fs.Expected(t,
+		fs.MatchAnyFileMode,
+		fs.WithFile("file1", "content")))
+
+	dir.Remove()
+	_, err = os.Stat(dir.Path())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestIn(t *testing.T) {
+	base := fs.NewDir(t, t.Name())
+	dir := fs.NewDir(t, t.Name(), fs.In(base.Path()), fs.WithFile("file1", "content"))
+	assert.Equal(t, filepath.Dir(dir.Path()), base.Path())
+	assert.Regexp(t, `^TestIn-[0-9]+$`, filepath.Base(dir.Path()))
+	fs.Equal(t, dir.Path(), fs.Expected(t,
+		fs.MatchAnyFileMode,
+		fs.WithFile("file1", "content")))
+
+	file := fs.NewFile(t, t.Name(), fs.WithContent("content"), fs.In(base.Path()))
+	assert.Equal(t, filepath.Dir(file.Path()), base.Path())
+	content, err := os.ReadFile(file.Path())
+	assert.NoError(t, err)
+	assert.Equal(t, string(content), "content")
+
+	err = fs.In(t.TempDir())(dir)
+	assert.ErrorContains(t, err, "must be the first PathOp")
+
+	deterministic := fs.NewDir(t, t.Name(), fs.In(base.Path()), fs.WithDeterministicName())
+	assert.Equal(t, deterministic.Path(), base.Join(t.Name()+"-1"))
+}
+
+func TestInTempDir(t *testing.T) {
+	var dir *fs.Dir
+	t.Run("sub", func(t *testing.T) {
+		dir = fs.NewDir(t, t.Name(), fs.InTempDir(t), fs.WithFile("file1", "content"))
+		file := fs.NewFile(t, t.Name(), fs.InTempDir(t))
+		assert.Equal(t, filepath.Dir(filepath.Dir(file.Path())), filepath.Dir(filepath.Dir(dir.Path())))
+		fs.Equal(t, dir.Path(), fs.Expected(t,
+			fs.MatchAnyFileMode,
+			fs.WithFile("file1", "content")))
+	})
+	_, err := os.Stat(filepath.Dir(dir.Path()))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWithDeterministicName(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(), fs.WithDeterministicName(), fs.WithFile("file1", "content"))
+	assert.Equal(t, dir.Path(), filepath.Join(os.TempDir(), t.Name()+"-1"))
+	fs.Equal(t, dir.Path(), fs.Expected(t,
+		fs.MatchAnyFileMode,
+		fs.WithFile("file1", "content")))
+
+	// The path of a Dir which was kept is not reused
+	collision := filepath.Join(os.TempDir(), t.Name()+"-2")
+	assert.NoError(t, os.Mkdir(collision, 0700))
+	defer os.Remove(collision)
+	other := fs.NewDir(t, t.Name(), fs.WithDeterministicName())
+	assert.Equal(t, other.Path(), filepath.Join(os.TempDir(), t.Name()+"-3"))
+
+	file := fs.NewFile(t, t.Name()+"-file", fs.WithContent("content"), fs.WithDeterministicName())
+	assert.Equal(t, file.Path(), filepath.Join(os.TempDir(), t.Name()+"-file-1"))
+	content, err := os.ReadFile(file.Path())
+	assert.NoError(t, err)
+	assert.Equal(t, string(content), "content")
+}
+
+func TestDirMakeReadOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directory permissions are not enforced on windows")
+	}
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithFile("file1", "content", fs.WithMode(0640)),
+		fs.WithDir("sub", fs.WithMode(0750)))
+
+	assert.NoError(t, dir.MakeReadOnly())
+	err := os.WriteFile(dir.Join("file1"), []byte("changed"), 0644)
+	assert.True(t, err != nil)
+	err = os.WriteFile(dir.Join("sub", "file2"), []byte("new"), 0644)
+	assert.True(t, err != nil)
+
+	assert.NoError(t, dir.MakeWritable())
+	assert.NoError(t, os.WriteFile(dir.Join("sub", "file2"), []byte("new"), 0644))
+	fs.Equal(t, dir.Path(), fs.Expected(t,
+		fs.MatchAnyFileMode,
+		fs.WithFile("file1", "content", fs.WithMode(0640)),
+		fs.WithDir("sub", fs.WithMode(0750), fs.WithFile("file2", "new"))))
+
+	assert.NoError(t, dir.MakeReadOnly())
+	dir.Remove()
+	_, err = os.Stat(dir.Path())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDirRemoveWithNoAccess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directory permissions are not enforced on windows")
+	}
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithDir("locked",
+			fs.WithDir("nested", fs.WithFile("file1", "")),
+			fs.WithNoAccess()))
+
+	info, err := os.Stat(dir.Join("locked"))
+	assert.NoError(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0))
+
+	dir.Remove()
+	_, err = os.Stat(dir.Path())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestRemoveWithReadOnlyFiles(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithDir("sub",
+			fs.WithFile("file1", "", fs.WithMode(0400)),
+			fs.WithMode(0500)))
+	dir.Remove()
+	_, err := os.Stat(dir.Path())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	file := fs.NewFile(t, t.Name(), fs.WithMode(0400))
+	file.Remove()
+	_, err = os.Stat(file.Path())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestRemoveE(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(), fs.WithFile("file1", ""))
+	file := fs.NewFile(t, t.Name())
+	assert.NoError(t, dir.RemoveE())
+	assert.NoError(t, file.RemoveE())
+	// Removing a path which no longer exists is not an error.
+	assert.NoError(t, dir.RemoveE())
+	assert.NoError(t, file.RemoveE())
+
+	invalid := fs.DirFromPath(t, "invalid\x00path")
+	assert.True(t, invalid.RemoveE() != nil)
+}
+
+func TestKeepOnFailure(t *testing.T) {
+	if os.Getenv("FSTEST_CLEANUP_HELPER") != "" {
+		fs.NewDir(t, "kept", fs.KeepOnFailure())
+		fs.NewDir(t, "removed")
+		t.Fail()
+		return
+	}
+
+	kept := runCleanupHelper(t, "TestKeepOnFailure", false)
+	assert.Equal(t, len(kept), 1)
+	assert.True(t, strings.HasPrefix(filepath.Base(kept[0]), "kept-"), kept[0])
+	_, err := os.Stat(kept[0])
+	assert.NoError(t, err)
+}
+
+func TestCleanupPolicy(t *testing.T) {
+	if os.Getenv("FSTEST_CLEANUP_HELPER") != "" {
+		fs.NewDir(t, "delete", fs.WithCleanupPolicy(fs.CleanupDelete))
+		fs.NewFile(t, "keep", fs.WithCleanupPolicy(fs.CleanupKeep))
+		fs.NewDir(t, "matching", fs.WithCleanupPolicy(fs.CleanupKeepMatching("Policy$")))
+		fs.NewDir(t, "default")
+		if os.Getenv("FSTEST_CLEANUP_HELPER_FAIL") != "" {
+			t.Fail()
+		}
+		return
+	}
+
+	kept := runCleanupHelper(t, "TestCleanupPolicy", true)
+	assert.Equal(t, len(kept), 2)
+	assert.True(t, strings.HasPrefix(filepath.Base(kept[0]), "keep-"), kept[0])
+	assert.True(t, strings.HasPrefix(filepath.Base(kept[1]), "matching-"), kept[1])
+
+	kept = runCleanupHelper(t, "TestCleanupPolicy", true, "FSTEST_CLEANUP=keep")
+	assert.Equal(t, len(kept), 4)
+
+	kept = runCleanupHelper(t, "TestCleanupPolicy", true, "TEST_NOCLEANUP=true")
+	assert.Equal(t, len(kept), 4)
+
+	kept = runCleanupHelper(t, "TestCleanupPolicy", true, "FSTEST_CLEANUP=keep-on-failure")
+	assert.Equal(t, len(kept), 0)
+
+	kept = runCleanupHelper(t, "TestCleanupPolicy", false,
+		"FSTEST_CLEANUP=keep-on-failure", "FSTEST_CLEANUP_HELPER_FAIL=1")
+	assert.Equal(t, len(kept), 4)
+}
+
+// runCleanupHelper runs the test named name in a new process, with the helper
+// part of the test enabled, and returns the paths which were kept.
+func runCleanupHelper(t *testing.T, name string, pass bool, env ...string) []string {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^"+name+"$", "-test.v")
+	cmd.Env = append(os.Environ(), "FSTEST_CLEANUP_HELPER=1")
+	cmd.Env = append(cmd.Env, env...)
+	out, err := cmd.CombinedOutput()
+	assert.Equal(t, err == nil, pass, string(out))
+
+	var kept []string
+	for _, match := range regexp.MustCompile(`keeping (\S+)`).FindAllSubmatch(out, -1) {
+		kept = append(kept, string(match[1]))
+		t.Cleanup(func() { os.RemoveAll(string(match[1])) })
+	}
+	sort.Strings(kept)
+	return kept
+}
+
+func TestRemoveKeepsModeOfLinkedFiles(t *testing.T) {
+	shared := fs.NewFile(t, t.Name(), fs.WithMode(0400))
+	dir := fs.NewDir(t, t.Name(), fs.WithDir("sub"))
+	assert.NoError(t, os.Link(shared.Path(), dir.Join("sub", "shared")))
+	assert.NoError(t, os.Chmod(dir.Join("sub"), 0500))
+	dir.Remove()
+	_, err := os.Stat(dir.Path())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	info, err := os.Stat(shared.Path())
+	assert.NoError(t, err)
+	assert.Zero(t, info.Mode().Perm()&0200)
+}
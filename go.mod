@@ -2,10 +2,21 @@ module github.com/goslogan/assertfs
 
 go 1.23.2
 
-require github.com/stretchr/testify v1.10.0
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/pkg/sftp v1.13.6
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/spf13/afero v1.11.0
+	github.com/stretchr/testify v1.10.0
+	golang.org/x/sys v0.16.0
+	golang.org/x/text v0.14.0
+	gopkg.in/yaml.v3 v3.0.1
+	gotest.tools/v3 v3.5.2
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	github.com/google/go-cmp v0.5.9 // indirect
+	github.com/kr/fs v0.1.0 // indirect
+	golang.org/x/crypto v0.18.0 // indirect
 )
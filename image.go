@@ -0,0 +1,83 @@
+package fs
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mkfsArgs are the arguments used to create a filesystem of each type without
+// prompting.
+var mkfsArgs = map[string][]string{
+	"ext2": {"-F", "-q"},
+	"ext3": {"-F", "-q"},
+	"ext4": {"-F", "-q"},
+}
+
+// NewImageDir returns a new [Dir] which is the root of a filesystem of type
+// fsType, such as ext4, vfat or exfat, in a loopback image of size bytes. The
+// PathOps are applied after the filesystem is mounted. NewImageDir can be used to
+// test behaviour which is specific to a filesystem, such as case insensitive
+// names, a lack of symlinks, or a small limit on the length of names.
+//
+// Creating the filesystem requires the mkfs tool for fsType, and mounting it
+// requires root on Linux. The test is skipped if the image can not be created
+// or mounted. The filesystem is unmounted and the image is removed when the test
+// ends.
+func NewImageDir(t *testing.T, fsType string, size int64, ops ...PathOp) *Dir {
+	t.Helper()
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("filesystem images can only be mounted by root on Linux")
+	}
+	mkfs, err := exec.LookPath("mkfs." + fsType)
+	if err != nil {
+		t.Skipf("filesystem %s is not supported: %s", fsType, err)
+	}
+
+	image := NewFile(t, "image-"+fsType)
+	assert.Nil(t, os.Truncate(image.Path(), size))
+	if out, err := exec.Command(mkfs, append(mkfsArgs[fsType], image.Path())...).CombinedOutput(); err != nil {
+		t.Skipf("failed to create %s filesystem: %s: %s", fsType, err, out)
+	}
+
+	dir := NewDir(t, "mount-"+fsType)
+	if out, err := exec.Command("mount", "-o", "loop", image.Path(), dir.Path()).CombinedOutput(); err != nil {
+		t.Skipf("failed to mount %s filesystem: %s: %s", fsType, err, out)
+	}
+	t.Cleanup(func() {
+		out, err := exec.Command("umount", dir.Path()).CombinedOutput()
+		assert.Nil(t, err, string(out))
+	})
+
+	assert.Nil(t, applyPathOps(dir, ops))
+	return dir
+}
+
+// NewLimitedDir returns a new [Dir] on a tmpfs which can hold at most size
+// bytes, so that the handling of ENOSPC errors can be tested deterministically.
+// The PathOps are applied after the tmpfs is mounted, and count towards the
+// limit. Like [NewImageDir] the test is skipped unless it is run by root on
+// Linux.
+func NewLimitedDir(t *testing.T, prefix string, size int64, ops ...PathOp) *Dir {
+	t.Helper()
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("size limited directories can only be mounted by root on Linux")
+	}
+
+	dir := NewDir(t, prefix)
+	options := "size=" + strconv.FormatInt(size, 10)
+	if out, err := exec.Command("mount", "-t", "tmpfs", "-o", options, "tmpfs", dir.Path()).CombinedOutput(); err != nil {
+		t.Skipf("failed to mount tmpfs: %s: %s", err, out)
+	}
+	t.Cleanup(func() {
+		out, err := exec.Command("umount", dir.Path()).CombinedOutput()
+		assert.Nil(t, err, string(out))
+	})
+
+	assert.Nil(t, applyPathOps(dir, ops))
+	return dir
+}
@@ -0,0 +1,30 @@
+package fs_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	fs "github.com/goslogan/assertfs"
+	"gotest.tools/v3/assert"
+)
+
+func TestNewImageDir(t *testing.T) {
+	dir := fs.NewImageDir(t, "ext4", 4<<20, fs.WithFile("file1", "content"))
+
+	content, err := os.ReadFile(dir.Join("file1"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "content")
+	_, err = os.Stat(dir.Join("lost+found"))
+	assert.NilError(t, err)
+}
+
+func TestNewLimitedDir(t *testing.T) {
+	dir := fs.NewLimitedDir(t, t.Name(), 64<<10, fs.WithFile("file1", "content"))
+
+	err := os.WriteFile(dir.Join("large"), make([]byte, 128<<10), 0644)
+	assert.ErrorIs(t, err, syscall.ENOSPC)
+	content, err := os.ReadFile(dir.Join("file1"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "content")
+}
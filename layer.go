@@ -0,0 +1,83 @@
+package fs
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	whiteoutPrefix    = ".wh."
+	whiteoutOpaqueDir = ".wh..wh..opq"
+)
+
+// ManifestFromLayers creates a [Manifest] of the filesystem produced by
+// extracting the OCI or Docker image layers in order. Each layer is a tar
+// archive, which may be compressed with gzip.
+//
+// Whiteout files in a layer remove the entry they name from the lower layers,
+// and an opaque whiteout removes all the entries from lower layers in its
+// directory. Whiteout files are not included in the manifest.
+//
+// ManifestFromLayers can be used with [EqualManifest] to compare the effective
+// filesystem of an image to an expected structure.
+func ManifestFromLayers(t assert.TestingT, layers ...io.Reader) Manifest {
+	if ht, ok := t.(helperT); ok {
+		ht.Helper()
+	}
+
+	manifest, err := manifestFromLayers(layers)
+	assert.Nil(t, err)
+	return manifest
+}
+
+func manifestFromLayers(layers []io.Reader) (Manifest, error) {
+	b := newArchiveBuilder()
+	for _, layer := range layers {
+		r, err := maybeDecompress(layer)
+		if err != nil {
+			return Manifest{}, err
+		}
+		b.layer = make(map[string]bool)
+		if err := b.addTar(r); err != nil {
+			return Manifest{}, err
+		}
+	}
+	return Manifest{root: b.root}, nil
+}
+
+func maybeDecompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+// addWhiteout removes the entries hidden by the whiteout file at name from the
+// lower layers.
+func (b *archiveBuilder) addWhiteout(name string) error {
+	name = cleanArchivePath(name)
+	dirName := path.Dir(name)
+	dir, err := b.directory(dirName)
+	if err != nil {
+		return err
+	}
+
+	base := path.Base(name)
+	if base == whiteoutOpaqueDir {
+		for item := range dir.items {
+			if !b.layer[joinFSPath(dirName, item)] {
+				delete(dir.items, item)
+			}
+		}
+		return nil
+	}
+	delete(dir.items, strings.TrimPrefix(base, whiteoutPrefix))
+	return nil
+}
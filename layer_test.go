@@ -0,0 +1,61 @@
+package fs_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	fs "github.com/goslogan/assertfs"
+	"gotest.tools/v3/assert"
+)
+
+func TestManifestFromLayers(t *testing.T) {
+	lower := newLayer(t,
+		"etc/", "",
+		"etc/config", "lower",
+		"etc/old.conf", "old",
+		"var/cache/a", "a",
+		"var/cache/b", "b")
+	upper := newLayer(t,
+		"etc/config", "upper",
+		"etc/.wh.old.conf", "",
+		"var/cache/c", "c",
+		"var/cache/.wh..wh..opq", "")
+
+	expected := fs.Expected(t,
+		fs.WithDir("etc",
+			fs.WithFile("config", "upper")),
+		fs.WithDir("var",
+			fs.WithDir("cache",
+				fs.WithFile("c", "c"))))
+	manifest := fs.ManifestFromLayers(t, lower, upper)
+	assert.Assert(t, fs.EqualManifest(t, manifest, expected))
+}
+
+// newLayer returns a tar archive containing pairs of names and content. Names
+// ending in a slash are directories.
+func newLayer(t *testing.T, entries ...string) io.Reader {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for i := 0; i < len(entries); i += 2 {
+		header := &tar.Header{
+			Name:     entries[i],
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+			Size:     int64(len(entries[i+1])),
+			Uid:      os.Getuid(),
+			Gid:      os.Getgid(),
+		}
+		if entries[i][len(entries[i])-1] == '/' {
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0755
+		}
+		assert.NilError(t, tw.WriteHeader(header))
+		_, err := tw.Write([]byte(entries[i+1]))
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, tw.Close())
+	return buf
+}
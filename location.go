@@ -0,0 +1,153 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// In is a [PathOp] which moves a new [Dir] or [File] to baseDir, instead of
+// the default temporary directory, so that it is on the same filesystem as the
+// files used by the test, or inside a mounted volume. The name of the Dir or
+// File still has a random suffix. In must be passed before any PathOp which
+// creates files in the Dir. When used with a [Manifest] In has no effect.
+//
+//	dir := fs.NewDir(t, "rename", fs.In(volume), fs.WithFile("file1", ""))
+func In(baseDir string) PathOp {
+	return func(path Path) error {
+		return relocate(path, baseDir)
+	}
+}
+
+// InTempDir is a [PathOp] which moves a new [Dir] or [File] into the
+// directory returned by t.TempDir, so that the files of each test are grouped
+// under one directory which is removed by the testing package when the test
+// ends. InTempDir must be passed before any PathOp which creates files in the
+// Dir. When used with a [Manifest] InTempDir has no effect.
+func InTempDir(t testing.TB) PathOp {
+	return func(path Path) error {
+		switch path.(type) {
+		case *Dir, *File:
+			return relocate(path, t.TempDir())
+		}
+		return nil
+	}
+}
+
+// WithDeterministicName is a [PathOp] which renames a new [Dir] or [File] so
+// that its name is the prefix passed to [NewDir] or [NewFile] followed by a
+// counter, instead of a random suffix, so that the path is the same every time
+// the test runs and can be used in golden files. The counter starts at 1 and is
+// incremented for every Dir or File created with the same prefix in the same
+// directory. If the path already exists, for example because it was kept by a
+// [CleanupPolicy], the counter is incremented until a free path is found.
+//
+// WithDeterministicName must be passed before any PathOp which creates files in
+// the Dir. When used with a [Manifest] WithDeterministicName has no effect.
+func WithDeterministicName() PathOp {
+	return func(path Path) error {
+		return moveTo(path, func(current string, isDir bool) (string, error) {
+			parent := filepath.Dir(current)
+			return createDeterministic(parent, trimRandomSuffix(filepath.Base(current)), isDir)
+		})
+	}
+}
+
+// deterministicNames stores the last counter used for each name.
+var deterministicNames = struct {
+	sync.Mutex
+	counters map[string]int
+}{counters: make(map[string]int)}
+
+func createDeterministic(parent, name string, isDir bool) (string, error) {
+	deterministicNames.Lock()
+	defer deterministicNames.Unlock()
+	key := filepath.Join(parent, name)
+	for {
+		deterministicNames.counters[key]++
+		path := key + "-" + strconv.Itoa(deterministicNames.counters[key])
+		err := createEmpty(path, isDir)
+		if os.IsExist(err) {
+			continue
+		}
+		return path, err
+	}
+}
+
+// trimRandomSuffix removes the suffix added by os.MkdirTemp and os.CreateTemp
+// to the prefix of a Dir or File.
+func trimRandomSuffix(name string) string {
+	if i := strings.LastIndex(name, "-"); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
+func createEmpty(path string, isDir bool) error {
+	if isDir {
+		return os.Mkdir(path, 0700)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// relocate moves a new, empty, Dir or File to a new temporary path in root.
+// The new name is the prefix of the current name followed by a new random
+// suffix.
+func relocate(path Path, root string) error {
+	return moveTo(path, func(current string, isDir bool) (string, error) {
+		pattern := trimRandomSuffix(filepath.Base(current)) + "-"
+		if isDir {
+			return os.MkdirTemp(root, pattern)
+		}
+		f, err := os.CreateTemp(root, pattern)
+		if err != nil {
+			return "", err
+		}
+		return f.Name(), f.Close()
+	})
+}
+
+// moveTo moves a new, empty, Dir or File to the path returned by create.
+// create must create an empty directory, or an empty file, at the new path.
+func moveTo(path Path, create func(current string, isDir bool) (string, error)) error {
+	switch typed := path.(type) {
+	case *Dir:
+		newPath, err := create(typed.path, true)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(typed.path); err != nil {
+			_ = os.Remove(newPath)
+			return fmt.Errorf("failed to move %s, it must be the first PathOp: %w", typed.path, err)
+		}
+		register(newPath)
+		unregister(typed.path)
+		typed.path = newPath
+	case *File:
+		content, err := os.ReadFile(typed.path)
+		if err != nil {
+			return err
+		}
+		newPath, err := create(typed.path, false)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(newPath, content, 0600); err != nil {
+			_ = os.Remove(newPath)
+			return err
+		}
+		register(newPath)
+		_ = os.Remove(typed.path)
+		unregister(typed.path)
+		typed.path = newPath
+	}
+	return nil
+}
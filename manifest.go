@@ -1,10 +1,19 @@
 package fs
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	iofs "io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -19,13 +28,44 @@ type resource struct {
 	mode os.FileMode
 	uid  uint32
 	gid  uint32
+	// modeMask selects the bits of the mode which are compared, when it is
+	// not zero.
+	modeMask os.FileMode
+	// owner and group are the names of the expected owner, which are compared
+	// instead of the uid and gid when they are not empty.
+	owner string
+	group string
+	// modTime is the modification time of an actual resource.
+	modTime time.Time
+	// matchModTime is the expected modification time, when it is not nil.
+	matchModTime *modTimeExpectation
+}
+
+type modTimeExpectation struct {
+	description string
+	match       func(modTime time.Time) bool
 }
 
 type file struct {
 	resource
-	content             io.ReadCloser
-	ignoreCariageReturn bool
-	compareContentFunc  func(b []byte) CompareResult
+	content               io.ReadCloser
+	ignoreCariageReturn   bool
+	ignoreTrailingNewline bool
+	ignoreWhitespace      bool
+	compareContentFunc    func(b []byte) CompareResult
+	contentFunc           func(path string, content []byte) error
+	readerFunc            func(r io.Reader) error
+	// matchers are compared in addition to the expected content. The actual
+	// file must match all of them.
+	matchers []fileMatcher
+	// info is the result of stat for an actual file read from a directory.
+	info os.FileInfo
+	// sameFileAs is the slash separated path, relative to the root, of a file
+	// which must be the same file.
+	sameFileAs string
+	// extents are the ranges of the file which contain data, when the layout
+	// of the file is compared.
+	extents []Extent
 }
 
 func (f *file) Type() string {
@@ -45,6 +85,10 @@ type directory struct {
 	resource
 	items         map[string]dirEntry
 	filepathGlobs map[string]*filePath
+	// anyContents is true when the entries in the directory are not compared.
+	anyContents bool
+	// aggregates are expectations of the whole subtree of the directory.
+	aggregates []func(actual *directory) []problem
 }
 
 func (f *directory) Type() string {
@@ -55,20 +99,38 @@ type dirEntry interface {
 	Type() string
 }
 
+// absent is an entry which is expected to not exist.
+type absent struct{}
+
+func (a *absent) Type() string {
+	return "absent entry"
+}
+
+func isAbsent(entry dirEntry) bool {
+	_, ok := entry.(*absent)
+	return ok
+}
+
 // ManifestFromDir creates a [Manifest] by reading the directory at path. The
 // manifest stores the structure and properties of files in the directory.
 // ManifestFromDir can be used with [Equal] to compare two directories.
-func ManifestFromDir(t assert.TestingT, path string) Manifest {
+// Subdirectories are read concurrently, using at most GOMAXPROCS goroutines.
+// Files are only opened when their content is compared, and are closed once
+// the comparison is done.
+//
+// Entries which are ignored by a [CompareOption], such as [WithIgnorePatterns],
+// are not included in the manifest. Other options are ignored.
+func ManifestFromDir(t assert.TestingT, path string, opts ...CompareOption) Manifest {
 	if ht, ok := t.(helperT); ok {
 		ht.Helper()
 	}
 
-	manifest, err := manifestFromDir(path)
+	manifest, err := manifestFromDir(path, newCompareOptions(opts))
 	assert.Nil(t, err)
 	return manifest
 }
 
-func manifestFromDir(path string) (Manifest, error) {
+func manifestFromDir(path string, opts *compareOptions) (Manifest, error) {
 	info, err := os.Stat(path)
 	switch {
 	case err != nil:
@@ -77,22 +139,85 @@ func manifestFromDir(path string) (Manifest, error) {
 		return Manifest{}, fmt.Errorf("path %s must be a directory", path)
 	}
 
-	directory, err := newDirectory(path, info)
+	r := &dirReader{
+		root: path,
+		opts: opts,
+		sem:  make(chan struct{}, runtime.GOMAXPROCS(0)),
+	}
+	directory, err := r.newDirectory(path, info)
 	return Manifest{root: directory}, err
 }
 
-func newDirectory(path string, info os.FileInfo) (*directory, error) {
-	items := make(map[string]dirEntry)
+// dirReader reads a directory into a manifest, using the options which change
+// which entries are read and how they are named. Entries are read concurrently
+// by at most cap(sem) extra goroutines.
+type dirReader struct {
+	root string
+	opts *compareOptions
+	sem  chan struct{}
+}
+
+func (r *dirReader) skip(path string, isDir bool) bool {
+	rel, err := filepath.Rel(r.root, path)
+	return err == nil && r.opts.ignored(rel, isDir)
+}
+
+func (r *dirReader) name(name string) string {
+	if r.opts.normalizeName != nil {
+		return r.opts.normalizeName(name)
+	}
+	return name
+}
+
+func (r *dirReader) newDirectory(path string, info os.FileInfo) (*directory, error) {
 	children, err := os.ReadDir(path)
 	if err != nil {
 		return nil, err
 	}
-	for _, child := range children {
+
+	if err := r.opts.ctx.Err(); err != nil {
+		return nil, err
+	}
+	results := make([]struct {
+		entry dirEntry
+		err   error
+	}, len(children))
+	var wg sync.WaitGroup
+	for i, child := range children {
 		fullPath := filepath.Join(path, child.Name())
-		items[child.Name()], err = getTypedResource(fullPath, child)
-		if err != nil {
-			return nil, err
+		if r.skip(fullPath, child.IsDir()) {
+			children[i] = nil
+			continue
+		}
+		result := &results[i]
+		// Read the entry in a new goroutine when the pool has room, and
+		// otherwise read it in this one, so that nested directories can
+		// never wait on their parents for a slot.
+		select {
+		case r.sem <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer func() { <-r.sem; wg.Done() }()
+				result.entry, result.err = r.getTypedResource(fullPath, child)
+			}()
+		default:
+			result.entry, result.err = r.getTypedResource(fullPath, child)
+		}
+	}
+	wg.Wait()
+
+	// Collect the results in directory order so that errors and name
+	// collisions are resolved the same way on every run.
+	items := make(map[string]dirEntry)
+	for i, child := range children {
+		if child == nil {
+			continue
+		}
+		if results[i].err != nil {
+			return nil, results[i].err
 		}
+		r.opts.progress.add(1, 0)
+		items[r.name(child.Name())] = results[i].entry
 	}
 
 	return &directory{
@@ -102,19 +227,26 @@ func newDirectory(path string, info os.FileInfo) (*directory, error) {
 	}, nil
 }
 
-func getTypedResource(path string, entry os.DirEntry) (dirEntry, error) {
+func (r *dirReader) getTypedResource(path string, entry os.DirEntry) (dirEntry, error) {
 	info, err := entry.Info()
 	if err != nil {
 		return nil, err
 	}
 	switch {
 	case info.IsDir():
-		return newDirectory(path, info)
+		return r.newDirectory(path, info)
 	case info.Mode()&os.ModeSymlink != 0:
 		return newSymlink(path, info)
 	// TODO: devices, pipes?
 	default:
-		return newFile(path, info)
+		f := newFile(path, info)
+		content := f.content.(*lazyFile)
+		content.ctx = r.opts.ctx
+		content.progress = r.opts.progress
+		if r.opts.sparseLayout {
+			return f, readExtents(f)
+		}
+		return f, nil
 	}
 }
 
@@ -129,14 +261,356 @@ func newSymlink(path string, info os.FileInfo) (*symlink, error) {
 	}, err
 }
 
-func newFile(path string, info os.FileInfo) (*file, error) {
-	// TODO: defer file opening to reduce number of open FDs?
-	readCloser, err := os.Open(path)
+func newFile(path string, info os.FileInfo) *file {
+	return &file{
+		resource: newResourceFromInfo(info),
+		content:  &lazyFile{path: path},
+		info:     info,
+	}
+}
+
+// lazyFile is the content of a file which is not opened until it is first
+// read, so that building a manifest of a large directory does not use a file
+// descriptor per file. Entries which are never compared are never opened.
+type lazyFile struct {
+	path string
+	// ctx stops the file from being opened once it is done.
+	ctx context.Context
+	// progress is reported with the number of bytes of each Read.
+	progress *progressReporter
+	file     *os.File
+	closed   bool
+}
+
+func (f *lazyFile) Read(b []byte) (int, error) {
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.file == nil {
+		if f.ctx != nil && f.ctx.Err() != nil {
+			return 0, f.ctx.Err()
+		}
+		file, err := os.Open(f.path)
+		if err != nil {
+			return 0, err
+		}
+		f.file = file
+	}
+	n, err := f.file.Read(b)
+	if n > 0 {
+		f.progress.add(0, int64(n))
+	}
+	return n, err
+}
+
+func (f *lazyFile) Close() error {
+	f.closed = true
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+// ManifestFromFS creates a [Manifest] by reading the files in fsys. The manifest
+// stores the structure and properties of files in fsys. ManifestFromFS can be
+// used with [EqualManifest] to compare virtual filesystems, such as an
+// [embed.FS] or a [testing/fstest.MapFS], to an expected structure.
+//
+// Ownership is only available when fsys reports it, and otherwise defaults to
+// the current user.
+func ManifestFromFS(t assert.TestingT, fsys iofs.FS) Manifest {
+	if ht, ok := t.(helperT); ok {
+		ht.Helper()
+	}
+
+	manifest, err := manifestFromFS(fsys)
+	assert.Nil(t, err)
+	return manifest
+}
+
+func manifestFromFS(fsys iofs.FS) (Manifest, error) {
+	info, err := iofs.Stat(fsys, ".")
+	switch {
+	case err != nil:
+		return Manifest{}, err
+	case !info.IsDir():
+		return Manifest{}, fmt.Errorf("root of %T must be a directory", fsys)
+	}
+
+	directory, err := newDirectoryFromFS(fsys, ".", info)
+	return Manifest{root: directory}, err
+}
+
+func newDirectoryFromFS(fsys iofs.FS, path string, info iofs.FileInfo) (*directory, error) {
+	items := make(map[string]dirEntry)
+	children, err := iofs.ReadDir(fsys, path)
 	if err != nil {
 		return nil, err
 	}
-	return &file{
-		resource: newResourceFromInfo(info),
-		content:  readCloser,
-	}, err
+	for _, child := range children {
+		fullPath := joinFSPath(path, child.Name())
+		items[child.Name()], err = getTypedResourceFromFS(fsys, fullPath, child)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &directory{
+		resource:      newResourceFromInfo(info),
+		items:         items,
+		filepathGlobs: make(map[string]*filePath),
+	}, nil
+}
+
+func getTypedResourceFromFS(fsys iofs.FS, path string, entry iofs.DirEntry) (dirEntry, error) {
+	info, err := entry.Info()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case info.IsDir():
+		return newDirectoryFromFS(fsys, path, info)
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := readLinkFS(fsys, path)
+		if err != nil {
+			return nil, err
+		}
+		return &symlink{
+			resource: newResourceFromInfo(info),
+			target:   filepath.FromSlash(target),
+		}, nil
+	default:
+		content, err := fsys.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return &file{
+			resource: newResourceFromInfo(info),
+			content:  content,
+		}, nil
+	}
+}
+
+// joinFSPath joins a name to a directory using the slash separated paths
+// required by [iofs.FS].
+func joinFSPath(dir, name string) string {
+	if dir == "." {
+		return name
+	}
+	return dir + "/" + name
+}
+
+// String returns the structure and properties of the manifest as an indented
+// tree, with entries sorted by name. Each entry shows its mode, and the size of
+// files or the target of symlinks.
+func (m Manifest) String() string {
+	buf := new(bytes.Buffer)
+	if m.root == nil {
+		return ""
+	}
+	writeManifestEntry(buf, "", "/", m.root)
+	return buf.String()
+}
+
+func writeManifestEntry(buf *bytes.Buffer, indent, name string, entry dirEntry) {
+	switch typed := entry.(type) {
+	case *directory:
+		fmt.Fprintf(buf, "%s%s %s\n", indent, formatMode(typed.mode), strings.TrimSuffix(name, "/")+"/")
+		if name == "/" {
+			indent = ""
+		} else {
+			indent += "  "
+		}
+		if typed.anyContents {
+			fmt.Fprintf(buf, "%s... (any contents)\n", indent)
+			return
+		}
+		for _, child := range sortedKeys(typed.items) {
+			if child == anyFile {
+				fmt.Fprintf(buf, "%s%s (any other entries)\n", indent, anyFile)
+				continue
+			}
+			writeManifestEntry(buf, indent, child, typed.items[child])
+		}
+		for _, glob := range sortedGlobs(typed.filepathGlobs) {
+			f := typed.filepathGlobs[glob].file
+			fmt.Fprintf(buf, "%s%s glob %s (%s)\n", indent, formatMode(f.mode), glob, formatContent(f))
+		}
+	case *symlink:
+		fmt.Fprintf(buf, "%s%s %s -> %s\n", indent, formatMode(typed.mode), name, typed.target)
+	case *file:
+		fmt.Fprintf(buf, "%s%s %s (%s)\n", indent, formatMode(typed.mode), name, formatContent(typed))
+	case *absent:
+		fmt.Fprintf(buf, "%s%s (expected to be missing)\n", indent, name)
+	case *customEntry:
+		fmt.Fprintf(buf, "%s%s (%s)\n", indent, name, typed.Type())
+	}
+}
+
+func formatMode(mode os.FileMode) string {
+	if mode == anyFileMode {
+		return "(any mode)"
+	}
+	return mode.String()
+}
+
+// formatContent describes the content of a file. The size of an actual file is
+// read from its file info. Otherwise the content is read into memory so that
+// it can still be compared.
+func formatContent(f *file) string {
+	switch {
+	case f.compareContentFunc != nil, f.contentFunc != nil, f.readerFunc != nil, len(f.matchers) > 0:
+		return "custom content"
+	case f.info != nil:
+		return fmt.Sprintf("%d bytes", f.info.Size())
+	case f.content == anyFileContent:
+		return "any content"
+	case f.content == nil:
+		return "no content"
+	}
+	content, err := io.ReadAll(f.content)
+	f.content.Close()
+	f.content = io.NopCloser(bytes.NewReader(content))
+	if err != nil {
+		return fmt.Sprintf("failed to read content: %s", err)
+	}
+	return fmt.Sprintf("%d bytes", len(content))
+}
+
+func sortedGlobs(globs map[string]*filePath) []string {
+	keys := make([]string, 0, len(globs))
+	for key := range globs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Tree returns the structure of the directory at path as an indented listing
+// of every entry with its mode, and the size of files or the target of
+// symlinks. Tree is intended for logging the actual state of a directory when
+// a comparison fails. If the directory can not be read the error is returned
+// in place of the listing.
+func Tree(path string) string {
+	manifest, err := manifestFromDir(path, newCompareOptions(nil))
+	if err != nil {
+		return fmt.Sprintf("failed to read directory: %s", err)
+	}
+	defer manifest.close()
+	return manifest.String()
+}
+
+// Entry is a read-only view of an entry in a [Manifest].
+type Entry struct {
+	// Type is "file", "directory", or "symlink", or the kind of an
+	// [EntryMatcher].
+	Type string
+	// Mode is the expected mode, unless AnyMode is true.
+	Mode    os.FileMode
+	AnyMode bool
+	UID     uint32
+	GID     uint32
+	// Size is the size of the expected content of a file, or -1 when a file
+	// may have any content or its content is compared by a matcher.
+	Size int64
+	// Target is the target of a symlink.
+	Target string
+}
+
+// Walk calls fn for each entry in the manifest, starting with the root, in
+// lexical order. The path of the root is ".", and the path of other entries is
+// slash separated and relative to the root. If fn returns [iofs.SkipDir] for a
+// directory its entries are skipped. If fn returns SkipDir for any other entry
+// the remaining entries of its directory are skipped, as with
+// [filepath.WalkDir]. Any other error stops the walk and is returned by Walk.
+func (m Manifest) Walk(fn func(path string, entry Entry) error) error {
+	err := walkEntry(".", m.root, fn)
+	if errors.Is(err, iofs.SkipDir) {
+		return nil
+	}
+	return err
+}
+
+func walkEntry(path string, entry dirEntry, fn func(string, Entry) error) error {
+	if err := fn(path, newEntry(entry)); err != nil {
+		return err
+	}
+	dir, ok := entry.(*directory)
+	if !ok {
+		return nil
+	}
+	for _, name := range sortedKeys(dir.items) {
+		if name == anyFile {
+			continue
+		}
+		err := walkEntry(joinFSPath(path, name), dir.items[name], fn)
+		switch {
+		case errors.Is(err, iofs.SkipDir) && isDirectory(dir.items[name]):
+			continue
+		case errors.Is(err, iofs.SkipDir):
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+	return nil
+}
+
+func newEntry(entry dirEntry) Entry {
+	e := Entry{Type: entry.Type(), Size: -1}
+	var res resource
+	switch typed := entry.(type) {
+	case *directory:
+		res = typed.resource
+	case *symlink:
+		res = typed.resource
+		e.Target = typed.target
+	case *file:
+		res = typed.resource
+		e.Size = contentSize(typed)
+	}
+	e.Mode, e.AnyMode = res.mode, res.mode == anyFileMode
+	if e.AnyMode {
+		e.Mode = 0
+	}
+	e.UID, e.GID = res.uid, res.gid
+	return e
+}
+
+// contentSize returns the size of the expected content of a file, or -1 if the
+// content is not known. The content is read into memory so that it can still be
+// compared.
+func contentSize(f *file) int64 {
+	switch {
+	case f.info != nil:
+		return f.info.Size()
+	case f.content == nil, f.content == anyFileContent, f.compareContentFunc != nil,
+		f.contentFunc != nil, f.readerFunc != nil, len(f.matchers) > 0:
+		return -1
+	}
+	content, err := io.ReadAll(f.content)
+	f.content.Close()
+	f.content = io.NopCloser(bytes.NewReader(content))
+	if err != nil {
+		return -1
+	}
+	return int64(len(content))
+}
+
+// close closes the content of every file in the manifest.
+func (m Manifest) close() {
+	closeEntry(m.root)
+}
+
+func closeEntry(entry dirEntry) {
+	switch typed := entry.(type) {
+	case *directory:
+		for _, item := range typed.items {
+			closeEntry(item)
+		}
+	case *file:
+		if typed.content != nil {
+			typed.content.Close()
+		}
+	}
 }
@@ -1,11 +1,16 @@
 package fs
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	iofs "io/fs"
 	"os"
 	"runtime"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -35,36 +40,57 @@ func TestManifestFromDir(t *testing.T) {
 		WithFile("x", "content x", userOps...))
 	defer srcDir.Remove()
 
+	withModTime := func(r resource, path string) resource {
+		info, err := os.Lstat(path)
+		assert.NoError(t, err)
+		r.modTime = info.ModTime()
+		return r
+	}
+
+	// Files are read lazily, when their content is compared.
+	lazyContent := func(path string) io.ReadCloser {
+		return &lazyFile{path: path, ctx: context.Background()}
+	}
+
 	expected := Manifest{
 		root: &directory{
-			resource: newResource(defaultRootDirMode),
+			resource: withModTime(newResource(defaultRootDirMode), srcDir.Path()),
 			items: map[string]dirEntry{
 				"j": &file{
-					resource: newResource(jFileMode),
-					content:  readCloser("content j"),
+					resource: withModTime(newResource(jFileMode), srcDir.Join("j")),
+					content:  lazyContent(srcDir.Join("j")),
 				},
 				"s": &directory{
-					resource: newResource(subDirMode),
+					resource: withModTime(newResource(subDirMode), srcDir.Join("s")),
 					items: map[string]dirEntry{
 						"k": &file{
-							resource: newResource(defaultFileMode),
-							content:  readCloser("content k"),
+							resource: withModTime(newResource(defaultFileMode), srcDir.Join("s", "k")),
+							content:  lazyContent(srcDir.Join("s", "k")),
 						},
 					},
 					filepathGlobs: map[string]*filePath{},
 				},
 				"f": &symlink{
-					resource: newResource(defaultSymlinkMode),
+					resource: withModTime(newResource(defaultSymlinkMode), srcDir.Join("f")),
 					target:   srcDir.Join("j"),
 				},
 				"x": &file{
-					resource: expectedUserResource,
-					content:  readCloser("content x"),
+					resource: withModTime(expectedUserResource, srcDir.Join("x")),
+					content:  lazyContent(srcDir.Join("x")),
 				},
 			},
 			filepathGlobs: map[string]*filePath{},
 		},
 	}
+	for _, name := range []string{"j", "x", "s/k"} {
+		entry := expected.root.items[name]
+		if name == "s/k" {
+			entry = expected.root.items["s"].(*directory).items["k"]
+		}
+		info, err := os.Lstat(srcDir.Join(name))
+		assert.NoError(t, err)
+		entry.(*file).info = info
+	}
 	actual := ManifestFromDir(t, srcDir.Path())
 	assert.Equal(t, actual, expected)
 	actual.root.items["j"].(*file).content.Close()
@@ -72,6 +98,47 @@ func TestManifestFromDir(t *testing.T) {
 	actual.root.items["s"].(*directory).items["k"].(*file).content.Close()
 }
 
+func TestManifestFromDirConcurrent(t *testing.T) {
+	var ops []PathOp
+	var expectedOps []PathOp
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("dir%02d", i)
+		ops = append(ops, WithDir(name,
+			WithFile("file", name),
+			WithDir("nested", WithFile("file", name))))
+		expectedOps = append(expectedOps, WithDir(name,
+			MatchAnyFileMode,
+			WithFile("file", name, MatchAnyFileMode),
+			WithDir("nested", MatchAnyFileMode, WithFile("file", name, MatchAnyFileMode))))
+	}
+	dir := NewDir(t, t.Name(), ops...)
+	defer dir.Remove()
+
+	expected := Expected(t, append(expectedOps, MatchAnyFileMode)...)
+	assert.True(t, EqualManifest(t, ManifestFromDir(t, dir.Path()), expected))
+	assert.Equal(t, Tree(dir.Path()), Tree(dir.Path()))
+}
+
+func TestManifestFromDirOpensFilesLazily(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("compared", "content"),
+		WithFile("ignored", "content"))
+	defer dir.Remove()
+
+	manifest := ManifestFromDir(t, dir.Path())
+	compared := manifest.root.items["compared"].(*file).content.(*lazyFile)
+	ignored := manifest.root.items["ignored"].(*file).content.(*lazyFile)
+	assert.Nil(t, compared.file)
+
+	expected := Expected(t,
+		MatchAnyFileMode,
+		WithFile("compared", "content", MatchAnyFileMode),
+		WithFile("ignored", "", MatchAnyFileMode, MatchAnyFileContent))
+	assert.True(t, EqualManifest(t, manifest, expected))
+	assert.True(t, compared.closed)
+	assert.Nil(t, ignored.file)
+}
+
 func TestSymlinks(t *testing.T) {
 	rootDirectory := NewDir(t, "root",
 		WithFile("foo.txt", "foo"),
@@ -83,6 +150,124 @@ func TestSymlinks(t *testing.T) {
 	assert.Equal(t, rootDirectory.Path(), expected)
 }
 
+func TestManifestFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a":     {Data: []byte("content a"), Mode: 0600},
+		"s/b":   {Data: []byte("content b"), Mode: 0644},
+		"s/c/d": {Data: []byte("content d"), Mode: 0755},
+	}
+
+	expected := Expected(t,
+		MatchAnyFileMode,
+		WithFile("a", "content a", WithMode(0600)),
+		WithDir("s",
+			MatchAnyFileMode,
+			WithFile("b", "content b"),
+			WithDir("c",
+				MatchAnyFileMode,
+				WithFile("d", "content d", WithMode(0755)))))
+	assert.True(t, EqualManifest(t, ManifestFromFS(t, fsys), expected))
+}
+
+func TestManifestString(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("default symlink modes are platform specific")
+	}
+	manifest := Expected(t,
+		WithMode(0700),
+		WithFile("file1", "contenta", WithMode(0400)),
+		WithDir("sub",
+			WithMode(0755),
+			WithFile("file2", "", MatchAnyFileContent, MatchAnyFileMode),
+			MatchExtraFiles),
+		WithSymlink("link1", "file1"),
+		MatchFilesWithGlob("*.go", MatchAnyFileMode, MatchAnyFileContent))
+
+	expected := `drwx------ /
+-r-------- file1 (8 bytes)
+Lrwxrwxrwx link1 -> file1
+drwxr-xr-x sub/
+  * (any other entries)
+  (any mode) file2 (any content)
+(any mode) glob *.go (any content)
+`
+	assert.Equal(t, expected, manifest.String())
+}
+
+func TestTree(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("modes are platform specific")
+	}
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "contenta", WithMode(0600)),
+		// The size is read from the file info, so the file is not opened.
+		WithFile("file3", "c", WithNoAccess()),
+		WithDir("sub",
+			WithFile("file2", "content")))
+
+	expected := `drwx------ /
+-rw------- file1 (8 bytes)
+---------- file3 (1 bytes)
+drwxr-xr-x sub/
+  -rw-r--r-- file2 (7 bytes)
+`
+	assert.Equal(t, expected, Tree(dir.Path()))
+}
+
 func readCloser(s string) io.ReadCloser {
 	return io.NopCloser(strings.NewReader(s))
 }
+
+func TestManifestWalk(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("modes are platform specific")
+	}
+	manifest := Expected(t,
+		WithMode(0700),
+		WithFile("file1", "content", WithMode(0600)),
+		WithDir("dir1",
+			MatchAnyFileMode,
+			WithFile("file2", "", MatchAnyFileContent),
+			WithDir("nested", WithFile("file3", ""))),
+		WithDir("skipped", WithFile("file4", "")),
+		WithSymlink("link1", "file1"))
+
+	var paths []string
+	entries := make(map[string]Entry)
+	err := manifest.Walk(func(path string, entry Entry) error {
+		paths = append(paths, path)
+		entries[path] = entry
+		if path == "skipped" {
+			return iofs.SkipDir
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{".", "dir1", "dir1/file2", "dir1/nested", "dir1/nested/file3", "file1", "link1", "skipped"}, paths)
+
+	assert.Equal(t, "directory", entries["."].Type)
+	assert.Equal(t, os.ModeDir|0700, entries["."].Mode)
+	assert.True(t, entries["dir1"].AnyMode)
+	assert.Equal(t, Entry{Type: "file", Mode: 0600, UID: currentUID(), GID: currentGID(), Size: 7}, entries["file1"])
+	assert.Equal(t, int64(-1), entries["dir1/file2"].Size)
+	assert.Equal(t, "file1", entries["link1"].Target)
+	assert.Equal(t, "file", entries["dir1/file2"].Type)
+
+	// SkipDir for a file skips the remaining entries of its directory.
+	paths = nil
+	err = manifest.Walk(func(path string, entry Entry) error {
+		paths = append(paths, path)
+		if path == "dir1/file2" {
+			return iofs.SkipDir
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{".", "dir1", "dir1/file2", "file1", "link1", "skipped", "skipped/file4"}, paths)
+
+	stop := errors.New("stop")
+	err = manifest.Walk(func(path string, entry Entry) error {
+		return stop
+	})
+	assert.Equal(t, stop, err)
+}
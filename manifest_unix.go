@@ -21,11 +21,17 @@ func init() {
 }
 
 func newResourceFromInfo(info os.FileInfo) resource {
-	statT := info.Sys().(*syscall.Stat_t)
+	statT, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		res := newResource(info.Mode())
+		res.modTime = info.ModTime()
+		return res
+	}
 	return resource{
-		mode: info.Mode(),
-		uid:  statT.Uid,
-		gid:  statT.Gid,
+		mode:    info.Mode(),
+		uid:     statT.Uid,
+		gid:     statT.Gid,
+		modTime: info.ModTime(),
 	}
 }
 
@@ -36,3 +42,11 @@ func (p *filePath) SetMode(mode os.FileMode) {
 func (p *directoryPath) SetMode(mode os.FileMode) {
 	p.directory.mode = mode | os.ModeDir
 }
+
+// linkCount returns the number of hard links to the file described by info.
+func linkCount(info os.FileInfo) uint64 {
+	if statT, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(statT.Nlink)
+	}
+	return 1
+}
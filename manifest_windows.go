@@ -8,7 +8,7 @@ const (
 )
 
 func newResourceFromInfo(info os.FileInfo) resource {
-	return resource{mode: info.Mode()}
+	return resource{mode: info.Mode(), modTime: info.ModTime()}
 }
 
 func (p *filePath) SetMode(mode os.FileMode) {
@@ -20,3 +20,9 @@ func (p *filePath) SetMode(mode os.FileMode) {
 func (p *directoryPath) SetMode(mode os.FileMode) {
 	p.directory.mode = defaultRootDirMode
 }
+
+// linkCount returns 1, because the number of hard links is not reported by
+// os.FileInfo on windows.
+func linkCount(info os.FileInfo) uint64 {
+	return 1
+}
@@ -0,0 +1,425 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// compareResult is the [CompareResult] returned by the matchers in this
+// package.
+type compareResult struct {
+	success bool
+	message string
+}
+
+func (r compareResult) Success() bool {
+	return r.success
+}
+
+func (r compareResult) FailureMessage() string {
+	return r.message
+}
+
+var resultSuccess = compareResult{success: true}
+
+func resultFailure(format string, args ...interface{}) CompareResult {
+	return compareResult{message: fmt.Sprintf(format, args...)}
+}
+
+// MatchContentRegexp is a [PathOp] that updates a [Manifest] so that the
+// content of the file at path must match the regular expression pattern. Use
+// anchors (^ and $) to require the entire content to match. Only the start of
+// large content is included in the failure message.
+func MatchContentRegexp(pattern string) PathOp {
+	return func(path Path) error {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		return MatchFileContent(func(content []byte) CompareResult {
+			if re.Match(content) {
+				return resultSuccess
+			}
+			return resultFailure("content %s does not match regexp %q", quoteContent(content), pattern)
+		})(path)
+	}
+}
+
+// maxQuotedContent is the number of bytes of content quoted in a failure
+// message.
+const maxQuotedContent = 256
+
+// quoteContent returns content quoted, or the start of content followed by its
+// size if it is longer than maxQuotedContent.
+func quoteContent(content []byte) string {
+	if len(content) <= maxQuotedContent {
+		return strconv.Quote(string(content))
+	}
+	return fmt.Sprintf("%q... (%d bytes)", content[:maxQuotedContent], len(content))
+}
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// MatchDigest is a [PathOp] that updates a [Manifest] so that the content of the
+// file at path must have the digest, in the form "algorithm:hex", such as
+// "sha256:2c26b4...". The supported algorithms are sha1, sha256, and sha512.
+// The content is streamed, so large files are not read into memory.
+func MatchDigest(digest string) PathOp {
+	return func(path Path) error {
+		algorithm, expected, ok := strings.Cut(digest, ":")
+		newHash, known := digestAlgorithms[algorithm]
+		if !ok || !known {
+			return fmt.Errorf("invalid digest %q: expected sha1, sha256, or sha512 algorithm", digest)
+		}
+		expected = strings.ToLower(expected)
+		return MatchReader(func(r io.Reader) error {
+			h := newHash()
+			if _, err := io.Copy(h, r); err != nil {
+				return err
+			}
+			if actual := hex.EncodeToString(h.Sum(nil)); actual != expected {
+				return fmt.Errorf("digest %s:%s does not match expected %s", algorithm, actual, digest)
+			}
+			return nil
+		})(path)
+	}
+}
+
+// MatchSize is a [PathOp] that updates a [Manifest] so that the file at path
+// must contain exactly size bytes.
+func MatchSize(size int64) PathOp {
+	return MatchSizeBetween(size, size)
+}
+
+// MatchSizeBetween is a [PathOp] that updates a [Manifest] so that the size of
+// the file at path must be at least min bytes, and at most max bytes. The size
+// of a file on disk is read from its file info, and its content is not read.
+func MatchSizeBetween(min, max int64) PathOp {
+	return func(path Path) error {
+		m, ok := path.(*filePath)
+		if !ok {
+			return nil
+		}
+		m.file.matchers = append(m.file.matchers, func(opts *compareOptions, path string, actual *file) []problem {
+			size, err := actualSize(actual)
+			if err != nil {
+				return []problem{errProblem("failed to read actual content", err)}
+			}
+			if err := checkRange("size", size, min, max); err != nil {
+				return []problem{contentProblem(err.Error())}
+			}
+			return nil
+		})
+		return nil
+	}
+}
+
+// actualSize returns the size of an actual file from its file info, or by
+// reading its content when the file info is not known.
+func actualSize(f *file) (int64, error) {
+	switch {
+	case f.info != nil:
+		return f.info.Size(), nil
+	case f.content == nil:
+		return 0, errors.New("actual content is nil")
+	}
+	return io.Copy(io.Discard, f.content)
+}
+
+// MatchLineCount is a [PathOp] that updates a [Manifest] so that the file at
+// path must contain exactly n lines. A final line which does not end with a
+// newline is counted as a line.
+func MatchLineCount(n int) PathOp {
+	return MatchLineCountBetween(n, n)
+}
+
+// MatchLineCountBetween is a [PathOp] that updates a [Manifest] so that the
+// number of lines in the file at path must be at least min, and at most max.
+// See [MatchLineCount] for how lines are counted.
+func MatchLineCountBetween(min, max int) PathOp {
+	return MatchReader(func(r io.Reader) error {
+		lines, err := countLines(r)
+		if err != nil {
+			return err
+		}
+		return checkRange("line count", lines, int64(min), int64(max))
+	})
+}
+
+func countLines(r io.Reader) (int64, error) {
+	var lines int64
+	var last byte = '\n'
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			lines += int64(bytes.Count(buf[:n], []byte("\n")))
+			last = buf[n-1]
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if last != '\n' {
+		lines++
+	}
+	return lines, nil
+}
+
+// checkRange returns an error if n is not between min and max.
+func checkRange(property string, n, min, max int64) error {
+	switch {
+	case min == max && n != min:
+		return fmt.Errorf("%s is %d, expected %d", property, n, min)
+	case n < min || n > max:
+		return fmt.Errorf("%s is %d, expected between %d and %d", property, n, min, max)
+	}
+	return nil
+}
+
+// MatchGolden is a [PathOp] that updates a [Manifest] so that the content of
+// the file at path must be equal to the content of the golden file filename.
+// A relative filename is relative to the working directory of the test, which
+// is normally the package directory.
+//
+// When the FSTEST_UPDATE env var is true, the golden file is written with the
+// actual content instead of compared:
+//
+//	FSTEST_UPDATE=true go test ./...
+func MatchGolden(filename string) PathOp {
+	return MatchFileContent(func(content []byte) CompareResult {
+		if updateGolden() {
+			if err := os.WriteFile(filename, content, 0o644); err != nil {
+				return resultFailure("failed to update golden file %s: %s", filename, err)
+			}
+			return resultSuccess
+		}
+		expected, err := os.ReadFile(filename)
+		if err != nil {
+			return resultFailure("failed to read golden file: %s", err)
+		}
+		if bytes.Equal(expected, content) {
+			return resultSuccess
+		}
+		diff := strings.TrimSuffix(unifiedDiff(string(expected), string(content), defaultDiffContext), "\n")
+		return resultFailure("does not match golden file %s:\n%s", filename, indent(diff, "    "))
+	})
+}
+
+func updateGolden() bool {
+	update, _ := strconv.ParseBool(os.Getenv("FSTEST_UPDATE"))
+	return update
+}
+
+// MatchJSON is a [PathOp] that updates a [Manifest] so that the content of the
+// file at path must be JSON which is structurally equal to expected. Key order
+// and whitespace are ignored. expected is encoded using [json.Marshal], unless
+// it is a []byte or [json.RawMessage], which must contain JSON.
+func MatchJSON(expected interface{}) PathOp {
+	return func(path Path) error {
+		raw, ok := expected.([]byte)
+		if msg, isRaw := expected.(json.RawMessage); isRaw {
+			raw, ok = msg, true
+		}
+		if !ok {
+			var err error
+			if raw, err = json.Marshal(expected); err != nil {
+				return err
+			}
+		}
+		var want interface{}
+		if err := json.Unmarshal(raw, &want); err != nil {
+			return fmt.Errorf("invalid expected JSON: %w", err)
+		}
+		return MatchFileContent(func(content []byte) CompareResult {
+			var got interface{}
+			if err := json.Unmarshal(content, &got); err != nil {
+				return resultFailure("failed to decode JSON: %s", err)
+			}
+			return compareDecoded("JSON", want, got, marshalIndentJSON)
+		})(path)
+	}
+}
+
+func marshalIndentJSON(v interface{}) (string, error) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	return string(out), err
+}
+
+// compareDecoded compares two decoded documents, and shows a diff of the
+// documents encoded in a canonical form when they are not equal.
+func compareDecoded(format string, want, got interface{}, encode func(interface{}) (string, error)) CompareResult {
+	if reflect.DeepEqual(want, got) {
+		return resultSuccess
+	}
+	x, xErr := encode(want)
+	y, yErr := encode(got)
+	if xErr != nil || yErr != nil {
+		return resultFailure("%s does not match: expected %v got %v", format, want, got)
+	}
+	diff := strings.TrimSuffix(unifiedDiff(x, y, defaultDiffContext), "\n")
+	return resultFailure("%s does not match:\n%s", format, indent(diff, "    "))
+}
+
+// MatchYAML is a [PathOp] that updates a [Manifest] so that the content of the
+// file at path must be YAML which is structurally equal to expected. Key order,
+// formatting, and comments are ignored. expected is encoded using
+// [yaml.Marshal], unless it is a []byte, which must contain YAML.
+func MatchYAML(expected interface{}) PathOp {
+	return func(path Path) error {
+		raw, ok := expected.([]byte)
+		if !ok {
+			var err error
+			if raw, err = yaml.Marshal(expected); err != nil {
+				return err
+			}
+		}
+		var want interface{}
+		if err := yaml.Unmarshal(raw, &want); err != nil {
+			return fmt.Errorf("invalid expected YAML: %w", err)
+		}
+		return MatchFileContent(func(content []byte) CompareResult {
+			var got interface{}
+			if err := yaml.Unmarshal(content, &got); err != nil {
+				return resultFailure("failed to decode YAML: %s", err)
+			}
+			return compareDecoded("YAML", want, got, marshalYAML)
+		})(path)
+	}
+}
+
+func marshalYAML(v interface{}) (string, error) {
+	out, err := yaml.Marshal(v)
+	return strings.TrimSuffix(string(out), "\n"), err
+}
+
+// MatchTOML is a [PathOp] that updates a [Manifest] so that the content of the
+// file at path must be TOML which is structurally equal to expected. Key order,
+// formatting, and comments are ignored. expected is encoded using a
+// [toml.Encoder], unless it is a []byte, which must contain TOML.
+func MatchTOML(expected interface{}) PathOp {
+	return func(path Path) error {
+		raw, ok := expected.([]byte)
+		if !ok {
+			var err error
+			if raw, err = encodeTOML(expected); err != nil {
+				return err
+			}
+		}
+		var want map[string]interface{}
+		if err := toml.Unmarshal(raw, &want); err != nil {
+			return fmt.Errorf("invalid expected TOML: %w", err)
+		}
+		return MatchFileContent(func(content []byte) CompareResult {
+			var got map[string]interface{}
+			if err := toml.Unmarshal(content, &got); err != nil {
+				return resultFailure("failed to decode TOML: %s", err)
+			}
+			return compareDecoded("TOML", want, got, marshalTOML)
+		})(path)
+	}
+}
+
+func marshalTOML(v interface{}) (string, error) {
+	out, err := encodeTOML(v)
+	return strings.TrimSuffix(string(out), "\n"), err
+}
+
+func encodeTOML(v interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := toml.NewEncoder(buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+// MatchXML is a [PathOp] that updates a [Manifest] so that the content of the
+// file at path must be XML which is equivalent to expected. Attribute order,
+// whitespace between elements, comments, and processing instructions are
+// ignored.
+func MatchXML(expected []byte) PathOp {
+	return func(path Path) error {
+		want, err := canonicalXML(expected)
+		if err != nil {
+			return fmt.Errorf("invalid expected XML: %w", err)
+		}
+		return MatchFileContent(func(content []byte) CompareResult {
+			got, err := canonicalXML(content)
+			if err != nil {
+				return resultFailure("failed to decode XML: %s", err)
+			}
+			return compareDecoded("XML", want, got, func(v interface{}) (string, error) {
+				return v.(string), nil
+			})
+		})(path)
+	}
+}
+
+// canonicalXML renders an XML document with one element or text node per
+// line, sorted attributes, and trimmed character data.
+func canonicalXML(data []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var lines []string
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		prefix := strings.Repeat("  ", depth)
+		switch token := token.(type) {
+		case xml.StartElement:
+			attrs := make([]string, 0, len(token.Attr))
+			for _, attr := range token.Attr {
+				attrs = append(attrs, fmt.Sprintf(" %s=%q", xmlName(attr.Name), attr.Value))
+			}
+			sort.Strings(attrs)
+			lines = append(lines, prefix+"<"+xmlName(token.Name)+strings.Join(attrs, "")+">")
+			depth++
+		case xml.EndElement:
+			depth--
+			lines = append(lines, strings.Repeat("  ", depth)+"</"+xmlName(token.Name)+">")
+		case xml.CharData:
+			if text := strings.TrimSpace(string(token)); text != "" {
+				lines = append(lines, prefix+text)
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return "", errors.New("empty document")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func xmlName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return "{" + name.Space + "}" + name.Local
+}
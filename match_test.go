@@ -0,0 +1,465 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestMatchContentRegexp(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("log", "started at 2024-01-02T03:04:05Z on host-123\n"))
+	defer dir.Remove()
+
+	t.Run("match", func(t *testing.T) {
+		manifest := Expected(t,
+			WithFile("log", "", MatchContentRegexp(`^started at \S+ on host-\d+\n$`)))
+		assert.Assert(t, Equal(t, dir.Path(), manifest))
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		manifest := Expected(t,
+			WithFile("log", "", MatchContentRegexp(`^stopped`)))
+		result := Compare(dir.Path(), manifest)
+		expected := fmtExpected(`directory %s does not match expected:
+/log
+  content: content "started at 2024-01-02T03:04:05Z on host-123\n" does not match regexp "^stopped"
+`, dir.Path())
+		assert.Equal(t, result.FailureMessage(), expected)
+	})
+
+	t.Run("mismatch with large content", func(t *testing.T) {
+		dir := NewDir(t, t.Name(), WithFile("log", strings.Repeat("x", 10000)))
+		defer dir.Remove()
+		manifest := Expected(t, WithFile("log", "", MatchContentRegexp(`^y`)))
+		result := Compare(dir.Path(), manifest)
+		expected := fmtExpected(`directory %s does not match expected:
+/log
+  content: content "%s"... (10000 bytes) does not match regexp "^y"
+`, dir.Path(), strings.Repeat("x", 256))
+		assert.Equal(t, result.FailureMessage(), expected)
+	})
+}
+
+func TestMatchJSON(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("config.json", `{"name": "app", "ports": [80, 443],
+			"debug": false}`))
+	defer dir.Remove()
+
+	t.Run("match", func(t *testing.T) {
+		expected := map[string]interface{}{
+			"debug": false,
+			"name":  "app",
+			"ports": []int{80, 443},
+		}
+		manifest := Expected(t, WithFile("config.json", "", MatchJSON(expected)))
+		assert.Assert(t, Equal(t, dir.Path(), manifest))
+	})
+
+	t.Run("match raw", func(t *testing.T) {
+		expected := []byte(`{"ports":[80,443],"name":"app","debug":false}`)
+		manifest := Expected(t, WithFile("config.json", "", MatchJSON(expected)))
+		assert.Assert(t, Equal(t, dir.Path(), manifest))
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		expected := []byte(`{"ports":[80],"name":"app","debug":false}`)
+		manifest := Expected(t, WithFile("config.json", "", MatchJSON(expected)))
+		result := Compare(dir.Path(), manifest)
+		expectedMsg := fmtExpected(`directory %s does not match expected:
+/config.json
+  content: JSON does not match:
+    --- expected
+    +++ actual
+    @@ -2,6 +2,7 @@
+       "debug": false,
+       "name": "app",
+       "ports": [
+    -    80
+    +    80,
+    +    443
+       ]
+     }
+`, dir.Path())
+		assert.Equal(t, result.FailureMessage(), expectedMsg)
+	})
+}
+
+func TestMatchYAML(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("config.yaml", "# generated\nname: app\nports:\n  - 80\n  - 443\n"))
+	defer dir.Remove()
+
+	t.Run("match", func(t *testing.T) {
+		expected := map[string]interface{}{
+			"ports": []int{80, 443},
+			"name":  "app",
+		}
+		manifest := Expected(t, WithFile("config.yaml", "", MatchYAML(expected)))
+		assert.Assert(t, Equal(t, dir.Path(), manifest))
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		expected := []byte("ports: [80]\nname: app\n")
+		manifest := Expected(t, WithFile("config.yaml", "", MatchYAML(expected)))
+		result := Compare(dir.Path(), manifest)
+		expectedMsg := fmtExpected(`directory %s does not match expected:
+/config.yaml
+  content: YAML does not match:
+    --- expected
+    +++ actual
+    @@ -1,3 +1,4 @@
+     name: app
+     ports:
+         - 80
+    +    - 443
+`, dir.Path())
+		assert.Equal(t, result.FailureMessage(), expectedMsg)
+	})
+}
+
+func TestMatchTOML(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("config.toml", "# generated\nname = \"app\"\nports = [80, 443]\n\n[log]\nlevel = \"info\"\n"))
+	defer dir.Remove()
+
+	t.Run("match", func(t *testing.T) {
+		expected := map[string]interface{}{
+			"log":   map[string]string{"level": "info"},
+			"ports": []int{80, 443},
+			"name":  "app",
+		}
+		manifest := Expected(t, WithFile("config.toml", "", MatchTOML(expected)))
+		assert.Assert(t, Equal(t, dir.Path(), manifest))
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		expected := []byte("name = \"app\"\nports = [80, 443]\n\n[log]\nlevel = \"debug\"\n")
+		manifest := Expected(t, WithFile("config.toml", "", MatchTOML(expected)))
+		result := Compare(dir.Path(), manifest)
+		expectedMsg := fmtExpected(`directory %s does not match expected:
+/config.toml
+  content: TOML does not match:
+    --- expected
+    +++ actual
+    @@ -2,4 +2,4 @@
+     ports = [80, 443]
+     
+     [log]
+    -  level = "debug"
+    +  level = "info"
+`, dir.Path())
+		assert.Equal(t, result.FailureMessage(), expectedMsg)
+	})
+}
+
+func TestMatchXML(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("report.xml", `<?xml version="1.0"?>
+<testsuite tests="2" name="pkg">
+  <!-- generated -->
+  <testcase name="a"/>
+  <testcase name="b">
+    <failure>boom</failure>
+  </testcase>
+</testsuite>`))
+	defer dir.Remove()
+
+	t.Run("match", func(t *testing.T) {
+		expected := `<testsuite name="pkg" tests="2"><testcase name="a"></testcase>` +
+			`<testcase name="b"><failure> boom </failure></testcase></testsuite>`
+		manifest := Expected(t, WithFile("report.xml", "", MatchXML([]byte(expected))))
+		assert.Assert(t, Equal(t, dir.Path(), manifest))
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		expected := `<testsuite name="pkg" tests="2"><testcase name="a"/><testcase name="b"/></testsuite>`
+		manifest := Expected(t, WithFile("report.xml", "", MatchXML([]byte(expected))))
+		result := Compare(dir.Path(), manifest)
+		expectedMsg := fmtExpected(`directory %s does not match expected:
+/report.xml
+  content: XML does not match:
+    --- expected
+    +++ actual
+    @@ -2,5 +2,8 @@
+       <testcase name="a">
+       </testcase>
+       <testcase name="b">
+    +    <failure>
+    +      boom
+    +    </failure>
+       </testcase>
+     </testsuite>
+`, dir.Path())
+		assert.Equal(t, result.FailureMessage(), expectedMsg)
+	})
+}
+
+func TestMatchContentFunc(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithDir("pkg",
+			WithFile("good.go", "package pkg\n"),
+			WithFile("bad.go", "package pkg\nfunc {")))
+	defer dir.Remove()
+
+	var paths []string
+	isGo := MatchContentFunc(func(path string, content []byte) error {
+		paths = append(paths, path)
+		_, err := parser.ParseFile(token.NewFileSet(), path, content, 0)
+		return err
+	})
+	manifest := Expected(t,
+		WithDir("pkg",
+			WithFile("good.go", "", isGo),
+			WithFile("bad.go", "", isGo)))
+	result := Compare(dir.Path(), manifest)
+	assert.Assert(t, !result.Success())
+	assert.Equal(t, len(result.Mismatches), 1)
+	assert.Equal(t, result.Mismatches[0].Path, filepath.Join("/pkg", "bad.go"))
+	assert.Equal(t, result.Mismatches[0].Kind, MismatchContent)
+
+	sort.Strings(paths)
+	assert.DeepEqual(t, paths, []string{"pkg/bad.go", "pkg/good.go"})
+}
+
+func TestMatchReader(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("data", strings.Repeat("x", 100000)))
+	defer dir.Remove()
+
+	countBytes := func(n int64) PathOp {
+		return MatchReader(func(r io.Reader) error {
+			count, err := io.Copy(io.Discard, r)
+			if err != nil {
+				return err
+			}
+			if count != n {
+				return fmt.Errorf("expected %d bytes got %d", n, count)
+			}
+			return nil
+		})
+	}
+
+	manifest := Expected(t, WithFile("data", "", countBytes(100000)))
+	assert.Assert(t, Equal(t, dir.Path(), manifest))
+
+	manifest = Expected(t, WithFile("data", "", countBytes(10)))
+	result := Compare(dir.Path(), manifest)
+	expected := fmtExpected(`directory %s does not match expected:
+/data
+  content: expected 10 bytes got 100000
+`, dir.Path())
+	assert.Equal(t, result.FailureMessage(), expected)
+}
+
+func TestMatchDigest(t *testing.T) {
+	dir := NewDir(t, t.Name(), WithFile("foo", "foo"))
+	defer dir.Remove()
+
+	const fooSHA256 = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+
+	t.Run("match", func(t *testing.T) {
+		manifest := Expected(t, WithFile("foo", "", MatchDigest("sha256:"+fooSHA256)))
+		assert.Assert(t, Equal(t, dir.Path(), manifest))
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		manifest := Expected(t, WithFile("foo", "", MatchDigest("sha1:0000")))
+		result := Compare(dir.Path(), manifest)
+		expected := fmtExpected(`directory %s does not match expected:
+/foo
+  content: digest sha1:0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33 does not match expected sha1:0000
+`, dir.Path())
+		assert.Equal(t, result.FailureMessage(), expected)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		err := MatchDigest("crc32:1234")(&filePath{file: &file{}})
+		assert.ErrorContains(t, err, `invalid digest "crc32:1234"`)
+	})
+}
+
+func TestMatchSize(t *testing.T) {
+	dir := NewDir(t, t.Name(), WithFile("log", "0123456789"))
+	defer dir.Remove()
+
+	assert.Assert(t, Equal(t, dir.Path(), Expected(t, WithFile("log", "", MatchSize(10)))))
+	assert.Assert(t, Equal(t, dir.Path(), Expected(t, WithFile("log", "", MatchSizeBetween(5, 10)))))
+
+	result := Compare(dir.Path(), Expected(t, WithFile("log", "", MatchSize(9))))
+	assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/log
+  content: size is 10, expected 9
+`, dir.Path()))
+
+	result = Compare(dir.Path(), Expected(t, WithFile("log", "", MatchSizeBetween(11, 20))))
+	assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/log
+  content: size is 10, expected between 11 and 20
+`, dir.Path()))
+
+	// The content is also compared when it is matched before or after the size.
+	const logSHA256 = "84d89877f0d4041efb6bf91a16f0248f2fd573e6af05c19f96bedb9f882f7882"
+	assert.Assert(t, Equal(t, dir.Path(), Expected(t,
+		WithFile("log", "", MatchDigest("sha256:"+logSHA256), MatchSize(10)))))
+	for _, ops := range [][]PathOp{
+		{MatchDigest("sha1:0000"), MatchSize(10)},
+		{MatchSize(10), MatchDigest("sha1:0000")},
+	} {
+		result = Compare(dir.Path(), Expected(t, WithFile("log", "", ops...)))
+		assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/log
+  content: digest sha1:87acec17cd9dcd20a716cc2cf67417b71c8a7016 does not match expected sha1:0000
+`, dir.Path()))
+	}
+
+	// The size is read from the file info, and the content is not read.
+	info, err := os.Stat(dir.Join("log"))
+	assert.NilError(t, err)
+	expected := Expected(t, WithFile("log", "", MatchSize(10))).root.items["log"].(*file)
+	actual := &file{
+		resource: newResourceFromInfo(info),
+		info:     info,
+		content:  io.NopCloser(iotest.ErrReader(errors.New("content was read"))),
+	}
+	assert.Equal(t, len(eqFile(newCompareOptions(nil), "log", expected, actual)), 0)
+}
+
+func TestMatchLineCount(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("records", "a\nb\nc\n"),
+		WithFile("partial", "a\nb"),
+		WithFile("empty", ""))
+	defer dir.Remove()
+
+	manifest := Expected(t,
+		WithFile("records", "", MatchLineCount(3)),
+		WithFile("partial", "", MatchLineCountBetween(1, 2)),
+		WithFile("empty", "", MatchLineCount(0)))
+	assert.Assert(t, Equal(t, dir.Path(), manifest))
+
+	result := Compare(dir.Path(), Expected(t,
+		WithFile("records", "", MatchLineCountBetween(4, 10)),
+		WithFile("partial", "", MatchAnyFileContent),
+		WithFile("empty", "")))
+	assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/records
+  content: line count is 3, expected between 4 and 10
+`, dir.Path()))
+}
+
+func TestMatchGolden(t *testing.T) {
+	dir := NewDir(t, t.Name(), WithFile("output", "line1\nline3"))
+	defer dir.Remove()
+	goldens := NewDir(t, t.Name(), WithFile("output.golden", "line1\nline2"))
+	defer goldens.Remove()
+	golden := goldens.Join("output.golden")
+
+	result := Compare(dir.Path(), Expected(t, WithFile("output", "", MatchGolden(golden))))
+	assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/output
+  content: does not match golden file %s:
+    --- expected
+    +++ actual
+    @@ -1,2 +1,2 @@
+     line1
+    -line2
+    +line3
+`, dir.Path(), golden))
+
+	t.Setenv("FSTEST_UPDATE", "true")
+	assert.Assert(t, Equal(t, dir.Path(), Expected(t, WithFile("output", "", MatchGolden(golden)))))
+	content, err := os.ReadFile(golden)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "line1\nline3")
+}
+
+func TestCombinedMatchers(t *testing.T) {
+	dir := NewDir(t, t.Name(), WithFile("log", "v1 started\nINFO ready"))
+	defer dir.Remove()
+
+	t.Run("match", func(t *testing.T) {
+		manifest := Expected(t, WithFile("log", "",
+			AllOf(MatchContentRegexp(`^v\d+`), MatchSizeBetween(0, 1024)),
+			Not(MatchContentRegexp("ERROR"))))
+		assert.Assert(t, Equal(t, dir.Path(), manifest))
+
+		manifest = Expected(t, WithFile("log", "",
+			AnyOf(WithContent("other"), MatchLineCount(2))))
+		assert.Assert(t, Equal(t, dir.Path(), manifest))
+	})
+
+	t.Run("AllOf mismatch", func(t *testing.T) {
+		manifest := Expected(t, WithFile("log", "",
+			AllOf(MatchContentRegexp(`^v\d+`), MatchSize(1), MatchLineCount(1))))
+		result := Compare(dir.Path(), manifest)
+		assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/log
+  content: size is 21, expected 1
+  content: line count is 2, expected 1
+`, dir.Path()))
+	})
+
+	t.Run("AnyOf mismatch", func(t *testing.T) {
+		manifest := Expected(t, WithFile("log", "",
+			AnyOf(MatchSize(1), MatchLineCount(1))))
+		result := Compare(dir.Path(), manifest)
+		assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/log
+  does not match any of:
+    - content: size is 21, expected 1
+    - content: line count is 2, expected 1
+`, dir.Path()))
+	})
+
+	t.Run("AnyOf without ops", func(t *testing.T) {
+		err := AnyOf()(&filePath{file: &file{}})
+		assert.ErrorContains(t, err, "AnyOf requires at least one PathOp")
+	})
+
+	t.Run("Not mismatch", func(t *testing.T) {
+		manifest := Expected(t, WithFile("log", "", Not(MatchContentRegexp("INFO"))))
+		result := Compare(dir.Path(), manifest)
+		assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/log
+  matches, but expected not to match
+`, dir.Path()))
+	})
+
+	t.Run("content mismatch", func(t *testing.T) {
+		manifest := Expected(t, WithFile("log", "other content", AllOf(MatchContentRegexp(`^v\d+`))))
+		result := Compare(dir.Path(), manifest)
+		assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/log
+  content:
+    --- expected
+    +++ actual
+    @@ -1 +1,2 @@
+    -other content
+    +v1 started
+    +INFO ready
+`, dir.Path()))
+	})
+
+	t.Run("AllOf and Not mismatch", func(t *testing.T) {
+		manifest := Expected(t, WithFile("log", "",
+			AllOf(MatchLineCount(1)), Not(MatchContentRegexp("INFO"))))
+		result := Compare(dir.Path(), manifest)
+		assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/log
+  content: line count is 2, expected 1
+  matches, but expected not to match
+`, dir.Path()))
+	})
+}
@@ -0,0 +1,14 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+const errorNotSameDevice syscall.Errno = 17
+
+func isCrossDevice(err error) bool {
+	var linkErr *os.LinkError
+	return errors.As(err, &linkErr) && errors.Is(linkErr.Err, errorNotSameDevice)
+}
@@ -2,11 +2,15 @@ package fs
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	iofs "io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/stretchr/testify/assert"
@@ -64,7 +68,7 @@ func WithBytes(raw []byte) PathOp {
 func WithReaderContent(r io.Reader) PathOp {
 	return func(path Path) error {
 		if m, ok := path.(manifestFile); ok {
-			m.SetContent(io.NopCloser(r))
+			m.SetContent(readerContent{r})
 			return nil
 		}
 		f, err := os.OpenFile(path.Path(), os.O_WRONLY, defaultFileMode)
@@ -77,6 +81,17 @@ func WithReaderContent(r io.Reader) PathOp {
 	}
 }
 
+// readerContent is the content set on a Manifest by WithReaderContent. The
+// reader can only be read once, so the content can not be hashed by
+// NewCachedDir without losing it.
+type readerContent struct {
+	io.Reader
+}
+
+func (readerContent) Close() error {
+	return nil
+}
+
 // AsUser changes ownership of the file system object at [Path]
 func AsUser(uid, gid int) PathOp {
 	return func(path Path) error {
@@ -101,7 +116,12 @@ func WithFile(filename, content string, ops ...PathOp) PathOp {
 		if err := createFile(fullpath, content); err != nil {
 			return err
 		}
-		return applyPathOps(&File{path: fullpath}, ops)
+		state := pathState(path)
+		if err := applyPathOps(&File{path: fullpath, apply: state}, ops); err != nil {
+			return err
+		}
+		state.trace("WithFile", fullpath)
+		return nil
 	}
 }
 
@@ -132,13 +152,147 @@ func WithFiles(files map[string]string) PathOp {
 	}
 }
 
+// WithNFiles creates count files in the directory at path. The name and content
+// of the i'th file are returned by name(i) and content(i). If content is nil the
+// files are empty. The files are created in batches by GOMAXPROCS goroutines,
+// which makes WithNFiles much faster than count [WithFile] ops for fixtures
+// with thousands of small files. WithNFiles returns an error if count is
+// negative.
+func WithNFiles(count int, name func(i int) string, content func(i int) string) PathOp {
+	if content == nil {
+		content = func(int) string { return "" }
+	}
+	return func(path Path) error {
+		if count < 0 {
+			return fmt.Errorf("WithNFiles count %d must not be negative", count)
+		}
+		if m, ok := path.(manifestDirectory); ok {
+			for i := 0; i < count; i++ {
+				if err := m.AddFile(name(i), WithContent(content(i)), WithMode(defaultFileMode)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		batches := min(runtime.GOMAXPROCS(0), count)
+		errs := make([]error, batches)
+		var wg sync.WaitGroup
+		for b := 0; b < batches; b++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := b * count / batches; i < (b+1)*count/batches; i++ {
+					fullpath := filepath.Join(path.Path(), filepath.FromSlash(name(i)))
+					if err := createFile(fullpath, content(i)); err != nil {
+						errs[b] = err
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
 // FromDir copies the directory tree from the source path into the new [Dir]
 func FromDir(source string) PathOp {
 	return func(path Path) error {
 		if _, ok := path.(manifestDirectory); ok {
 			return fmt.Errorf("use manifest.FromDir")
 		}
-		return copyDirectory(source, path.Path())
+		return copyDirectory(source, path.Path(), nil)
+	}
+}
+
+// FromDirWithProgress copies the directory tree from the source path into the
+// new [Dir], like [FromDir], and calls progress after every file, directory,
+// and symlink is copied, so that copying a large tree can log its progress.
+func FromDirWithProgress(source string, progress func(Progress)) PathOp {
+	return func(path Path) error {
+		if _, ok := path.(manifestDirectory); ok {
+			return fmt.Errorf("use manifest.FromDir")
+		}
+		return copyDirectory(source, path.Path(), &progressReporter{report: progress})
+	}
+}
+
+// FromFS copies the files and directories in fsys into the [Dir]. When used
+// with a [Manifest] the contents of fsys are added as expectations, which
+// allows fixtures such as a [testing/fstest.MapFS] to be used as the expected
+// structure of a directory.
+//
+// File modes and ownership are not copied from fsys, and are not compared when
+// the expectation is created by FromFS.
+func FromFS(fsys iofs.FS) PathOp {
+	return func(path Path) error {
+		ops, err := opsFromFS(fsys, ".")
+		if err != nil {
+			return err
+		}
+		return applyPathOps(path, ops)
+	}
+}
+
+func opsFromFS(fsys iofs.FS, dir string) ([]PathOp, error) {
+	entries, err := iofs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	ops := make([]PathOp, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		fullpath := name
+		if dir != "." {
+			fullpath = dir + "/" + name
+		}
+		switch {
+		case entry.IsDir():
+			dirOps, err := opsFromFS(fsys, fullpath)
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, WithDir(name, append(dirOps, MatchAnyFileMode)...))
+		case entry.Type()&iofs.ModeSymlink != 0:
+			target, err := readLinkFS(fsys, fullpath)
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, withSymlinkTarget(name, target))
+		default:
+			content, err := iofs.ReadFile(fsys, fullpath)
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, WithFile(name, "", WithBytes(content), MatchAnyFileMode))
+		}
+	}
+	return ops, nil
+}
+
+func readLinkFS(fsys iofs.FS, name string) (string, error) {
+	if rl, ok := fsys.(interface {
+		ReadLink(name string) (string, error)
+	}); ok {
+		return rl.ReadLink(name)
+	}
+	return "", fmt.Errorf("symlink %s: %T does not support reading links", name, fsys)
+}
+
+// withSymlinkTarget creates a symlink with target used exactly as given, unlike
+// WithSymlink which resolves target relative to the directory.
+func withSymlinkTarget(path, target string) PathOp {
+	return func(root Path) error {
+		if v, ok := root.(manifestDirectory); ok {
+			return v.AddSymlink(path, filepath.FromSlash(target))
+		}
+		return os.Symlink(filepath.FromSlash(target), filepath.Join(root.Path(), path))
 	}
 }
 
@@ -157,27 +311,125 @@ func WithDir(name string, ops ...PathOp) PathOp {
 		if err != nil {
 			return err
 		}
-		return applyPathOps(&Dir{path: fullpath}, ops)
+		state := pathState(path)
+		if err := applyPathOps(&Dir{path: fullpath, apply: state}, ops); err != nil {
+			return err
+		}
+		state.trace("WithDir", fullpath)
+		return nil
 	}
 }
 
 // Apply the PathOps to the [File]
+//
+// When the FSTEST_TRACE env var is true, every PathOp applied by Apply, [NewDir],
+// [NewFile], and the other functions which create a File or Dir is logged with
+// t.Logf, followed by the path, mode, and size of the file or directory it
+// created or changed, to help debug a fixture which is not what the test
+// expected.
 func Apply(t assert.TestingT, path Path, ops ...PathOp) {
 	if ht, ok := t.(helperT); ok {
 		ht.Helper()
 	}
-	assert.Nil(t, applyPathOps(path, ops))
+	assert.Nil(t, applyWithState(path, newApplyState(context.Background(), t), ops))
+}
+
+// ApplyContext applies the PathOps to the [File] or [Dir], like [Apply], and
+// stops applying them once ctx is done, so that building a very large fixture
+// can be stopped by the deadline of the test. ctx is checked before each PathOp,
+// including the PathOps of every [WithDir] and [WithFile].
+func ApplyContext(ctx context.Context, t assert.TestingT, path Path, ops ...PathOp) {
+	if ht, ok := t.(helperT); ok {
+		ht.Helper()
+	}
+	assert.Nil(t, applyWithState(path, newApplyState(ctx, t), ops))
+}
+
+// withContext returns ops which fail with the error from ctx once it is done.
+func withContext(ctx context.Context, ops []PathOp) []PathOp {
+	wrapped := make([]PathOp, len(ops))
+	for i, op := range ops {
+		wrapped[i] = func(path Path) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return op(path)
+		}
+	}
+	return wrapped
 }
 
 func applyPathOps(path Path, ops []PathOp) error {
+	state := pathState(path)
 	for _, op := range ops {
-		if err := op(path); err != nil {
+		if err := state.err(); err != nil {
+			return err
+		}
+		if err := state.applyOp(op, path); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// Concurrently applies ops to the [Path] using at most n goroutines, which can
+// speed up creating a large fixture on a slow filesystem. The ops must be
+// independent of each other, for example files and directories with different
+// names. The entries created by a [WithDir] op are still created after the
+// directory, in the same goroutine; wrap them in Concurrently to also create
+// them concurrently. Ops which change the directory itself, such as [WithMode],
+// should be applied after Concurrently.
+//
+// If more than one op fails, the error from the first failing op in ops is
+// returned. When used with a [Manifest] the ops are applied in order.
+func Concurrently(n int, ops ...PathOp) PathOp {
+	return func(path Path) error {
+		if _, ok := path.(manifestResource); ok || n < 2 {
+			return applyPathOps(path, ops)
+		}
+
+		errs := make([]error, len(ops))
+		sem := make(chan struct{}, n)
+		var wg sync.WaitGroup
+		for i, op := range ops {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer func() { <-sem; wg.Done() }()
+				errs[i] = applyPathOps(goroutinePath(path), []PathOp{op})
+			}()
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// goroutinePath returns a copy of a File or Dir for an op applied by
+// Concurrently, so that the op can set its own state on the copy.
+func goroutinePath(path Path) Path {
+	switch typed := path.(type) {
+	case *Dir:
+		return &Dir{path: typed.path, apply: typed.apply}
+	case *File:
+		return &File{path: typed.path, apply: typed.apply}
+	}
+	return path
+}
+
+// WithNoAccess removes every permission from the directory or file at [Path],
+// so that the handling of permission errors can be tested. WithNoAccess must be
+// the last PathOp passed to [WithDir], because no entries can be created in the
+// directory once it is applied. [Dir.Remove] restores the permissions so that
+// the directory can be removed.
+func WithNoAccess() PathOp {
+	return WithMode(0)
+}
+
 // WithMode sets the file mode on the directory or file at [Path]
 func WithMode(mode os.FileMode) PathOp {
 	return func(path Path) error {
@@ -189,7 +441,7 @@ func WithMode(mode os.FileMode) PathOp {
 	}
 }
 
-func copyDirectory(source, dest string) error {
+func copyDirectory(source, dest string, progress *progressReporter) error {
 	entries, err := os.ReadDir(source)
 	if err != nil {
 		return err
@@ -197,29 +449,32 @@ func copyDirectory(source, dest string) error {
 	for _, entry := range entries {
 		sourcePath := filepath.Join(source, entry.Name())
 		destPath := filepath.Join(dest, entry.Name())
-		err = copyEntry(entry, destPath, sourcePath)
+		size, err := copyEntry(entry, destPath, sourcePath, progress)
 		if err != nil {
 			return err
 		}
+		progress.add(1, size)
 	}
 	return nil
 }
 
-func copyEntry(entry os.DirEntry, destPath string, sourcePath string) error {
+// copyEntry copies the entry at sourcePath to destPath, and returns the size of
+// the file which was copied.
+func copyEntry(entry os.DirEntry, destPath string, sourcePath string, progress *progressReporter) (int64, error) {
 	if entry.IsDir() {
 		if err := os.Mkdir(destPath, 0755); err != nil {
-			return err
+			return 0, err
 		}
-		return copyDirectory(sourcePath, destPath)
+		return 0, copyDirectory(sourcePath, destPath, progress)
 	}
 	info, err := entry.Info()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if info.Mode()&os.ModeSymlink != 0 {
-		return copySymLink(sourcePath, destPath)
+		return 0, copySymLink(sourcePath, destPath)
 	}
-	return copyFile(sourcePath, destPath)
+	return info.Size(), copyFile(sourcePath, destPath)
 }
 
 func copySymLink(source, dest string) error {
@@ -230,7 +485,12 @@ func copySymLink(source, dest string) error {
 	return os.Symlink(link, dest)
 }
 
+// copyFile copies source to dest, using a copy-on-write clone when the
+// filesystem supports it so that large files are copied instantly.
 func copyFile(source, dest string) error {
+	if cloneFile(source, dest) == nil {
+		return nil
+	}
 	content, err := os.ReadFile(source)
 	if err != nil {
 		return err
@@ -1,14 +1,17 @@
 package fs_test
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
+	fs "github.com/goslogan/assertfs"
 	"gotest.tools/v3/assert"
-	"gotest.tools/v3/fs"
 )
 
 func TestFromDir(t *testing.T) {
@@ -23,7 +26,7 @@ func TestFromDir(t *testing.T) {
 			fs.WithDir("b",
 				fs.WithFile("1", "1\n"))))
 
-	assert.Assert(t, fs.Equal(dir.Path(), expected))
+	assert.Assert(t, fs.Equal(t, dir.Path(), expected))
 }
 
 func TestFromDirSymlink(t *testing.T) {
@@ -45,7 +48,38 @@ func TestFromDirSymlink(t *testing.T) {
 				fs.WithSymlink("4", "5"),
 			)))
 
-	assert.Assert(t, fs.Equal(dir.Path(), expected))
+	assert.Assert(t, fs.Equal(t, dir.Path(), expected))
+}
+
+func TestFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"1":     {Data: []byte("1\n")},
+		"a/1":   {Data: []byte("1\n")},
+		"a/2":   {Data: []byte("2\n")},
+		"a/b/1": {Data: []byte("1\n")},
+	}
+
+	t.Run("with dir", func(t *testing.T) {
+		dir := fs.NewDir(t, "test-from-fs", fs.FromFS(fsys))
+		defer dir.Remove()
+
+		expected := fs.Expected(t,
+			fs.WithFile("1", "1\n"),
+			fs.WithDir("a",
+				fs.WithFile("1", "1\n"),
+				fs.WithFile("2", "2\n"),
+				fs.WithDir("b",
+					fs.WithFile("1", "1\n"))))
+
+		assert.Assert(t, fs.Equal(t, dir.Path(), expected))
+	})
+
+	t.Run("with manifest", func(t *testing.T) {
+		dir := fs.NewDir(t, "test-from-fs", fs.FromDir("testdata/copy-test"))
+		defer dir.Remove()
+
+		assert.Assert(t, fs.Equal(t, dir.Path(), fs.Expected(t, fs.FromFS(fsys))))
+	})
 }
 
 func TestWithTimestamps(t *testing.T) {
@@ -76,7 +110,7 @@ func TestApply(t *testing.T) {
 		expected := fs.Expected(t,
 			fs.WithFile("file1", "contenta"),
 			fs.WithFile("file2", "contentb"))
-		assert.Assert(t, fs.Equal(tmpDir.Path(), expected))
+		assert.Assert(t, fs.Equal(t, tmpDir.Path(), expected))
 	})
 }
 
@@ -88,5 +122,120 @@ func TestWithReaderContent(t *testing.T) {
 	)
 	defer dir.Remove()
 	expected := fs.Expected(t, fs.WithFile("1", content))
-	assert.Assert(t, fs.Equal(dir.Path(), expected))
+	assert.Assert(t, fs.Equal(t, dir.Path(), expected))
+}
+
+func TestConcurrently(t *testing.T) {
+	var ops, expectedOps []fs.PathOp
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("file%02d", i)
+		ops = append(ops, fs.WithFile(name, name))
+		expectedOps = append(expectedOps, fs.WithFile(name, name))
+	}
+	dir := fs.NewDir(t, t.Name(),
+		fs.Concurrently(8, append(ops,
+			fs.WithDir("sub", fs.WithFile("nested", "nested")))...))
+	defer dir.Remove()
+
+	expected := fs.Expected(t,
+		fs.Concurrently(8, append(expectedOps,
+			fs.WithDir("sub", fs.WithFile("nested", "nested")))...))
+	assert.Assert(t, fs.Equal(t, dir.Path(), expected))
+
+	err := fs.Concurrently(4,
+		fs.WithFile("ok", ""),
+		fs.WithFile("missing/first", ""),
+		fs.WithFile("missing/second", ""))(dir)
+	assert.ErrorContains(t, err, "first")
+}
+
+func TestWithNFiles(t *testing.T) {
+	name := func(i int) string { return fmt.Sprintf("file%04d", i) }
+	content := func(i int) string { return fmt.Sprint(i) }
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithNFiles(1000, name, content),
+		fs.WithDir("empty", fs.WithNFiles(3, name, nil)))
+	defer dir.Remove()
+
+	expected := fs.Expected(t,
+		fs.WithNFiles(1000, name, content),
+		fs.WithDir("empty", fs.WithNFiles(3, name, nil)))
+	assert.Assert(t, fs.Equal(t, dir.Path(), expected))
+
+	err := fs.WithNFiles(-1, name, content)(dir)
+	assert.ErrorContains(t, err, "WithNFiles count -1 must not be negative")
+}
+
+func TestFromDirWithProgress(t *testing.T) {
+	var progress []fs.Progress
+	dir := fs.NewDir(t, t.Name(), fs.FromDirWithProgress("testdata/copy-test", func(p fs.Progress) {
+		progress = append(progress, p)
+	}))
+	count, err := dir.FileCount()
+	assert.NilError(t, err)
+	size, err := dir.TotalSize()
+	assert.NilError(t, err)
+
+	assert.Assert(t, len(progress) > count)
+	last := progress[len(progress)-1]
+	assert.Equal(t, last.Bytes, size)
+	for i := 1; i < len(progress); i++ {
+		assert.Equal(t, progress[i].Entries, progress[i-1].Entries+1)
+	}
+}
+
+func TestApplyContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := fs.NewDir(t, t.Name())
+	cancelOp := func(fs.Path) error {
+		cancel()
+		return nil
+	}
+
+	errT := &recordingT{}
+	fs.ApplyContext(ctx, errT, dir,
+		fs.WithDir("sub",
+			fs.WithFile("file1", ""),
+			cancelOp,
+			fs.WithFile("file2", "")),
+		fs.WithFile("file3", ""))
+	assert.Assert(t, errT.failed)
+	assert.Assert(t, fs.Equal(t, dir.Path(), fs.Expected(t,
+		fs.MatchAnyFileMode,
+		fs.WithDir("sub", fs.WithFile("file1", "")))))
+}
+
+func TestApplyContextConcurrently(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := fs.NewDir(t, t.Name())
+	cancelOp := func(fs.Path) error {
+		cancel()
+		return nil
+	}
+	waitOp := func(fs.Path) error {
+		<-ctx.Done()
+		return nil
+	}
+
+	// file1 is only applied once one of the other ops is done, after ctx is
+	// cancelled.
+	errT := &recordingT{}
+	fs.ApplyContext(ctx, errT, dir, fs.Concurrently(2,
+		cancelOp,
+		waitOp,
+		fs.WithFile("file1", "")))
+	assert.Assert(t, errT.failed)
+	_, err := os.Stat(dir.Join("file1"))
+	assert.Assert(t, os.IsNotExist(err))
+}
+
+// recordingT records failures instead of failing the test.
+type recordingT struct {
+	failed bool
+}
+
+func (r *recordingT) Errorf(string, ...interface{}) {
+	r.failed = true
 }
@@ -0,0 +1,435 @@
+package fs
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// CompareOption changes how a filesystem is compared to a [Manifest] by [Equal]
+// and the other comparison functions.
+type CompareOption func(*compareOptions)
+
+type compareOptions struct {
+	// ctx stops reading the directory once it is done.
+	ctx context.Context
+	// progress is reported for every entry and every read of file content.
+	progress      *progressReporter
+	transformers  []contentTransformer
+	comparers     []contentComparer
+	allMismatches bool
+	diffContext   int
+	// binaryDiffRanges is the number of differing ranges shown in the diff of
+	// binary content.
+	binaryDiffRanges int
+	maxMismatches    int
+	maxDiffLines     int
+	treeOutput       bool
+	jsonOutput       bool
+	rootPlaceholder  string
+	// ignoreCarriageReturn normalizes line endings in all text files.
+	ignoreCarriageReturn bool
+	ignoreModes          bool
+	ignoreOwnership      bool
+	extraFiles           bool
+	maxDepth             int
+	ignorePatterns       []string
+	// nameKeys normalize the names of entries before they are matched.
+	nameKeys []func(name string) string
+	// normalizeName is applied to the names of entries read from a directory.
+	normalizeName func(name string) string
+	// actualRoot is the root of the actual tree being compared, which is used
+	// to find the entries referenced by an expectation.
+	actualRoot   *directory
+	sparseLayout bool
+	// optionalEmptyDirs allows empty directories to be missing or unexpected.
+	optionalEmptyDirs bool
+	// hashComparison compares content by size and digest after the first
+	// hashFullDiffs content mismatches, which are counted by contentMismatches.
+	hashComparison    bool
+	hashFullDiffs     int
+	contentMismatches int
+}
+
+type contentTransformer struct {
+	pattern   string
+	transform func(content []byte) []byte
+}
+
+type contentComparer struct {
+	pattern string
+	compare func(expected, actual []byte) bool
+}
+
+func newCompareOptions(opts []CompareOption) *compareOptions {
+	o := &compareOptions{
+		ctx:              context.Background(),
+		diffContext:      defaultDiffContext,
+		binaryDiffRanges: defaultBinaryDiffRanges,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithContentTransformer is a [CompareOption] which applies transform to both
+// the expected and actual content of files which match pattern before the
+// content is compared. A transformer can be used to normalize content which
+// changes every time it is generated, such as timestamps.
+//
+// The pattern uses the syntax of [path.Match], and is matched against the slash
+// separated path of the file relative to the root of the comparison.
+func WithContentTransformer(pattern string, transform func(content []byte) []byte) CompareOption {
+	return func(o *compareOptions) {
+		o.transformers = append(o.transformers, contentTransformer{pattern: pattern, transform: transform})
+	}
+}
+
+// WithContentComparer is a [CompareOption] which uses compare to determine if
+// the content of files which match pattern is equal. See
+// [WithContentTransformer] for the syntax of pattern.
+func WithContentComparer(pattern string, compare func(expected, actual []byte) bool) CompareOption {
+	return func(o *compareOptions) {
+		o.comparers = append(o.comparers, contentComparer{pattern: pattern, compare: compare})
+	}
+}
+
+// WithAllMismatches is a [CompareOption] which reports every entry in a missing
+// or unexpected directory, instead of only the directory. This allows all of the
+// differences in a large tree to be fixed from a single failure.
+func WithAllMismatches() CompareOption {
+	return func(o *compareOptions) {
+		o.allMismatches = true
+	}
+}
+
+const defaultDiffContext = 3
+
+// WithDiffContext is a [CompareOption] which sets the number of unchanged lines
+// shown around each change in the diff of a file's content. The default is 3.
+func WithDiffContext(lines int) CompareOption {
+	return func(o *compareOptions) {
+		o.diffContext = lines
+	}
+}
+
+const defaultBinaryDiffRanges = 3
+
+// WithBinaryDiffRanges is a [CompareOption] which sets the number of differing
+// byte ranges shown in the hexdump of a binary file's content. The default is 3.
+func WithBinaryDiffRanges(ranges int) CompareOption {
+	return func(o *compareOptions) {
+		o.binaryDiffRanges = ranges
+	}
+}
+
+// WithHashComparison is a [CompareOption] which compares the content of files
+// by their size and SHA-256 digest, computed as the content is read. Files with
+// different sizes are not read, unless they are diffed. Only the first
+// fullDiffs files with different content are reported with a diff, and the
+// rest are reported by size, and by digest when their sizes are the same. This
+// reduces the time spent comparing and formatting failures for large trees
+// where many files differ.
+//
+// Files which need their whole content to be compared, such as those matched by
+// [WithContentTransformer], are always compared in full.
+func WithHashComparison(fullDiffs int) CompareOption {
+	return func(o *compareOptions) {
+		o.hashComparison = true
+		o.hashFullDiffs = fullDiffs
+	}
+}
+
+// WithMaxMismatches is a [CompareOption] which limits the number of mismatches
+// included in a failure message. The number of mismatches which are not shown
+// is included at the end of the message. [Result.Mismatches] always contains
+// every mismatch.
+func WithMaxMismatches(n int) CompareOption {
+	return func(o *compareOptions) {
+		o.maxMismatches = n
+	}
+}
+
+// WithMaxDiffLines is a [CompareOption] which limits the number of lines in the
+// diff of each file's content.
+func WithMaxDiffLines(n int) CompareOption {
+	return func(o *compareOptions) {
+		o.maxDiffLines = n
+	}
+}
+
+// WithTreeOutput is a [CompareOption] which formats the failure message as an
+// annotated tree of every entry, see [Result.Tree].
+func WithTreeOutput() CompareOption {
+	return func(o *compareOptions) {
+		o.treeOutput = true
+	}
+}
+
+// WithJSONOutput is a [CompareOption] which formats the mismatches in the
+// failure message as JSON, so they can be processed by other tools. See
+// [Result.MarshalJSON] for the format.
+func WithJSONOutput() CompareOption {
+	return func(o *compareOptions) {
+		o.jsonOutput = true
+	}
+}
+
+// WithRootPlaceholder is a [CompareOption] which replaces the path of the
+// directory being compared with placeholder, such as "<ROOT>", in the failure
+// message and in [Result.Mismatches]. The failure message is then the same
+// every time the test is run, even though the directory is randomly named.
+func WithRootPlaceholder(placeholder string) CompareOption {
+	return func(o *compareOptions) {
+		o.rootPlaceholder = placeholder
+	}
+}
+
+// WithIgnoreCarriageReturn is a [CompareOption] which ignores carriage return
+// discrepancies in every text file, as if each file in the [Manifest] used
+// [MatchContentIgnoreCarriageReturn]. Binary files are compared unchanged.
+func WithIgnoreCarriageReturn() CompareOption {
+	return func(o *compareOptions) {
+		o.ignoreCarriageReturn = true
+	}
+}
+
+// WithIgnoreModes is a [CompareOption] which ignores the mode of every file,
+// directory, and symlink, as if each used [MatchAnyFileMode]. This allows the
+// same [Manifest] to be used on platforms with different default modes.
+func WithIgnoreModes() CompareOption {
+	return func(o *compareOptions) {
+		o.ignoreModes = true
+	}
+}
+
+// WithIgnoreOwnership is a [CompareOption] which ignores the uid and gid of
+// every entry. This allows a [Manifest] captured by one user, such as root in a
+// container, to be compared to a tree created by another user.
+func WithIgnoreOwnership() CompareOption {
+	return func(o *compareOptions) {
+		o.ignoreOwnership = true
+	}
+}
+
+// WithExtraFiles is a [CompareOption] which allows every directory to contain
+// entries which are not in the [Manifest], as if each directory used
+// [MatchExtraFiles]. Only the entries in the manifest are compared.
+func WithExtraFiles() CompareOption {
+	return func(o *compareOptions) {
+		o.extraFiles = true
+	}
+}
+
+// WithMaxDepth is a [CompareOption] which only compares entries which are at
+// most depth levels below the root. Directories at the maximum depth must
+// exist, but their entries are not compared, as if they used
+// [MatchAnyDirContents]. For example, WithMaxDepth(1) compares only the entries
+// in the root directory.
+func WithMaxDepth(depth int) CompareOption {
+	return func(o *compareOptions) {
+		o.maxDepth = depth
+	}
+}
+
+// beyondMaxDepth returns true if the entries of the directory at dirPath are
+// deeper than the maximum depth.
+func (o *compareOptions) beyondMaxDepth(dirPath string) bool {
+	if o.maxDepth <= 0 {
+		return false
+	}
+	depth := 0
+	if rel := relativePath(dirPath); rel != "" {
+		depth = strings.Count(rel, "/") + 1
+	}
+	return depth >= o.maxDepth
+}
+
+// WithIgnorePatterns is a [CompareOption] which ignores every entry which
+// matches one of the patterns, using the rules of a .gitignore file:
+//
+//   - A pattern without a slash, such as "*.tmp", matches the name of an entry
+//     in any directory.
+//   - A pattern with a slash, such as "build/out" or ".git/**", matches the
+//     path of an entry relative to the root.
+//   - "**" matches zero or more directories, and a pattern ending in "/**"
+//     also matches the directory itself.
+//   - A pattern ending in a slash only matches directories.
+//   - A pattern starting with "!" includes an entry which was ignored by an
+//     earlier pattern.
+//
+// Ignored entries are skipped in both the expected [Manifest] and the actual
+// directory. WithIgnorePatterns can also be used with [ManifestFromDir].
+func WithIgnorePatterns(patterns ...string) CompareOption {
+	return func(o *compareOptions) {
+		o.ignorePatterns = append(o.ignorePatterns, patterns...)
+	}
+}
+
+// junkPatterns match files which are created by operating systems and editors.
+var junkPatterns = []string{
+	".DS_Store",
+	"._*",
+	"Thumbs.db",
+	"ehthumbs.db",
+	"desktop.ini",
+	"*.swp",
+	"*.swo",
+	"*~",
+	".#*",
+	"#*#",
+}
+
+// WithIgnoreJunkFiles is a [CompareOption] which ignores files which are created
+// by operating systems and editors, such as .DS_Store, Thumbs.db, desktop.ini,
+// and editor swap and backup files. See [WithIgnorePatterns].
+func WithIgnoreJunkFiles() CompareOption {
+	return WithIgnorePatterns(junkPatterns...)
+}
+
+// WithCaseInsensitiveNames is a [CompareOption] which matches the names of
+// expected and actual entries case-insensitively, as they are matched by the
+// default filesystems of macOS and Windows. Actual entries with names which
+// differ only in case are reported as mismatches.
+func WithCaseInsensitiveNames() CompareOption {
+	return func(o *compareOptions) {
+		o.nameKeys = append(o.nameKeys, strings.ToLower)
+	}
+}
+
+// WithUnicodeNormalization is a [CompareOption] which normalizes the names of
+// entries to form, usually [norm.NFC], before they are matched. macOS stores
+// names in NFD, so names which are written in NFC by a test may otherwise be
+// reported as missing. [ManifestFromDir] also stores the names of entries in
+// form when it is used with this option.
+func WithUnicodeNormalization(form norm.Form) CompareOption {
+	return func(o *compareOptions) {
+		o.nameKeys = append(o.nameKeys, form.String)
+		o.normalizeName = form.String
+	}
+}
+
+func (o *compareOptions) nameKey(name string) string {
+	for _, key := range o.nameKeys {
+		name = key(name)
+	}
+	return name
+}
+
+// matchNames returns a copy of the actual directory y, with each entry named
+// as the expected entry in x which has the same name key. Actual entries with
+// the same name key are reported as collisions.
+func (o *compareOptions) matchNames(x, y *directory) (*directory, []problem) {
+	expected := make(map[string]string, len(x.items))
+	for name := range x.items {
+		expected[o.nameKey(name)] = name
+	}
+
+	var p []problem
+	seen := make(map[string]string, len(y.items))
+	items := make(map[string]dirEntry, len(y.items))
+	for _, name := range sortedKeys(y.items) {
+		key := o.nameKey(name)
+		if other, ok := seen[key]; ok {
+			p = append(p, existenceProblem(MismatchUnexpected, name, "name collides with %s", other))
+			continue
+		}
+		seen[key] = name
+		if expectedName, ok := expected[key]; ok {
+			items[expectedName] = y.items[name]
+			continue
+		}
+		items[name] = y.items[name]
+	}
+	renamed := *y
+	renamed.items = items
+	return &renamed, p
+}
+
+// ignored returns true if the entry at entryPath is ignored. The last pattern
+// which matches the entry decides if it is ignored.
+func (o *compareOptions) ignored(entryPath string, isDir bool) bool {
+	rel := relativePath(entryPath)
+	ignored := false
+	for _, pattern := range o.ignorePatterns {
+		negate := strings.HasPrefix(pattern, "!")
+		if matchIgnorePattern(strings.TrimPrefix(pattern, "!"), rel, isDir) {
+			ignored = !negate
+		}
+	}
+	return ignored
+}
+
+func matchIgnorePattern(pattern, rel string, isDir bool) bool {
+	if strings.HasSuffix(pattern, "/") {
+		if !isDir {
+			return false
+		}
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	if !strings.Contains(pattern, "/") {
+		return matchDoublestar(pattern, path.Base(rel))
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok && isDir && matchDoublestar(prefix, rel) {
+		return true
+	}
+	return matchDoublestar(pattern, rel)
+}
+
+// WithOptionalEmptyDirs is a [CompareOption] which treats an empty directory as
+// equal to a directory which does not exist. An expected directory with no
+// entries may be missing, and an actual directory with no entries does not
+// need to be in the [Manifest].
+func WithOptionalEmptyDirs() CompareOption {
+	return func(o *compareOptions) {
+		o.optionalEmptyDirs = true
+	}
+}
+
+// redactRoot returns a replacer for the root of the comparison, or nil if the
+// root should not be replaced.
+func (o *compareOptions) redactRoot(root string) *strings.Replacer {
+	if o.rootPlaceholder == "" {
+		return nil
+	}
+	pairs := []string{}
+	if abs, err := filepath.Abs(root); err == nil && abs != root {
+		pairs = append(pairs, abs, o.rootPlaceholder)
+	}
+	pairs = append(pairs, root, o.rootPlaceholder)
+	return strings.NewReplacer(pairs...)
+}
+
+func (o *compareOptions) transform(path string, content []byte) []byte {
+	for _, t := range o.transformers {
+		if matchPattern(t.pattern, path) {
+			content = t.transform(content)
+		}
+	}
+	return content
+}
+
+func (o *compareOptions) comparer(path string) func(expected, actual []byte) bool {
+	for _, c := range o.comparers {
+		if matchPattern(c.pattern, path) {
+			return c.compare
+		}
+	}
+	return nil
+}
+
+// relativePath returns the slash separated path of an entry relative to the
+// root of the comparison.
+func relativePath(entryPath string) string {
+	return strings.TrimPrefix(filepath.ToSlash(entryPath), "/")
+}
+
+func matchPattern(pattern, entryPath string) bool {
+	ok, err := path.Match(pattern, relativePath(entryPath))
+	return err == nil && ok
+}
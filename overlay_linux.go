@@ -0,0 +1,14 @@
+package fs
+
+import (
+	"syscall"
+)
+
+func mountOverlay(lower, upper, work, target string) error {
+	data := "lowerdir=" + lower + ",upperdir=" + upper + ",workdir=" + work
+	return syscall.Mount("overlay", target, "overlay", 0, data)
+}
+
+func unmountOverlay(target string) error {
+	return syscall.Unmount(target, 0)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package fs
+
+import "errors"
+
+func mountOverlay(lower, upper, work, target string) error {
+	return errors.New("overlay mounts are not supported on this platform")
+}
+
+func unmountOverlay(target string) error {
+	return nil
+}
@@ -2,8 +2,12 @@ package fs
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -143,6 +147,25 @@ func MatchContentIgnoreCarriageReturn(path Path) error {
 	return nil
 }
 
+// MatchContentIgnoreTrailingNewline is a [PathOp] that ignores a discrepancy in
+// the final newline of a file, so that "foo\n" matches "foo".
+func MatchContentIgnoreTrailingNewline(path Path) error {
+	if m, ok := path.(*filePath); ok {
+		m.file.ignoreTrailingNewline = true
+	}
+	return nil
+}
+
+// MatchContentIgnoringWhitespace is a [PathOp] that ignores differences in
+// horizontal whitespace. Runs of spaces and tabs are treated as a single space,
+// and whitespace at the start and end of each line is ignored.
+func MatchContentIgnoringWhitespace(path Path) error {
+	if m, ok := path.(*filePath); ok {
+		m.file.ignoreWhitespace = true
+	}
+	return nil
+}
+
 const anyFile = "*"
 
 // MatchExtraFiles is a [PathOp] that updates a [Manifest] to allow a directory
@@ -154,6 +177,40 @@ func MatchExtraFiles(path Path) error {
 	return nil
 }
 
+// MatchAnyDirContents is a [PathOp] that updates a [Manifest] so that the
+// directory at path must exist, but the entries in the directory, and in all of
+// its subdirectories, are not compared.
+func MatchAnyDirContents(path Path) error {
+	if m, ok := path.(*directoryPath); ok {
+		m.directory.anyContents = true
+	}
+	return nil
+}
+
+// ExpectMissing is a [PathOp] that updates a [Manifest] so that the entry at the
+// slash separated path name, relative to the directory, must not exist. The
+// parent directories of name must already be in the manifest.
+func ExpectMissing(name string) PathOp {
+	return func(path Path) error {
+		m, ok := path.(*directoryPath)
+		if !ok {
+			return nil
+		}
+		dir := m.directory
+		parts := strings.Split(strings.Trim(filepath.ToSlash(name), "/"), "/")
+		for i, part := range parts[:len(parts)-1] {
+			sub, ok := dir.items[part].(*directory)
+			if !ok {
+				return fmt.Errorf("failed to expect %s to be missing: directory %s is not in the manifest",
+					name, strings.Join(parts[:i+1], "/"))
+			}
+			dir = sub
+		}
+		dir.items[parts[len(parts)-1]] = &absent{}
+		return nil
+	}
+}
+
 // CompareResult is the result of comparison.
 //
 // See [gotest.tools/v3/assert/cmp.StringResult] for a convenient implementation of
@@ -174,8 +231,51 @@ func MatchFileContent(f func([]byte) CompareResult) PathOp {
 	}
 }
 
+// MatchContentFunc is a [PathOp] that updates a [Manifest] to use f to validate
+// a file's content. f is called with the slash separated path of the file,
+// relative to the root of the comparison, and the content of the file. The
+// content does not match if f returns an error.
+func MatchContentFunc(f func(path string, content []byte) error) PathOp {
+	return func(path Path) error {
+		if m, ok := path.(*filePath); ok {
+			m.file.contentFunc = f
+		}
+		return nil
+	}
+}
+
+// MatchReader is a [PathOp] that updates a [Manifest] to use f to validate a
+// file's content as a stream, so that large files do not need to be read into
+// memory. The content does not match if f returns an error. Content
+// transformers and comparers are not applied to the stream.
+func MatchReader(f func(r io.Reader) error) PathOp {
+	return func(path Path) error {
+		if m, ok := path.(*filePath); ok {
+			m.file.readerFunc = f
+		}
+		return nil
+	}
+}
+
+// MatchSameFile is a [PathOp] that updates a [Manifest] so that the file at path
+// must be the same file as the file at target, for example because one is a
+// hard link to the other. target is a slash separated path relative to the
+// root of the comparison.
+func MatchSameFile(target string) PathOp {
+	return func(path Path) error {
+		if m, ok := path.(*filePath); ok {
+			m.file.sameFileAs = target
+		}
+		return nil
+	}
+}
+
 // MatchFilesWithGlob is a [PathOp] that updates a [Manifest] to match files using
 // glob pattern, and check them using the ops.
+//
+// A pattern which contains a ** element, such as "**/*.log", matches files in
+// any subdirectory. ** matches zero or more directories, and the pattern is
+// matched against the slash separated path relative to the directory.
 func MatchFilesWithGlob(glob string, ops ...PathOp) PathOp {
 	return func(path Path) error {
 		if m, ok := path.(*directoryPath); ok {
@@ -196,3 +296,153 @@ func MatchAnyFileMode(path Path) error {
 	}
 	return nil
 }
+
+// MatchModeMask is a [PathOp] that updates a [Manifest] so that only the bits of
+// the mode of the resource at path which are set in mask are compared, and
+// they must be equal to want. For example MatchModeMask(0o100, 0o100) requires
+// a file to be executable by the owner, and MatchModeMask(0o002, 0) requires it
+// to not be writable by others.
+func MatchModeMask(mask, want os.FileMode) PathOp {
+	return func(path Path) error {
+		switch m := path.(type) {
+		case *filePath:
+			m.file.mode, m.file.modeMask = want&mask, mask
+		case *directoryPath:
+			m.directory.mode, m.directory.modeMask = want&mask|os.ModeDir, mask
+		}
+		return nil
+	}
+}
+
+// MatchOwner is a [PathOp] that updates a [Manifest] so that the resource at
+// path must be owned by the user and group with the names owner and group. The
+// uid and gid of the actual resource are resolved to names before they are
+// compared, so the expectation does not depend on the numeric ids of a system.
+// An empty owner or group is not resolved to a name, and the uid or gid of the
+// expected resource is compared instead, as it is without MatchOwner.
+func MatchOwner(owner, group string) PathOp {
+	return func(path Path) error {
+		switch m := path.(type) {
+		case *filePath:
+			m.file.owner, m.file.group = owner, group
+		case *directoryPath:
+			m.directory.owner, m.directory.group = owner, group
+		}
+		return nil
+	}
+}
+
+// MatchModTimeWithin is a [PathOp] that updates a [Manifest] so that the
+// modification time of the resource at path must be within tolerance of ref.
+// Use a tolerance which allows for the granularity of filesystem timestamps.
+func MatchModTimeWithin(ref time.Time, tolerance time.Duration) PathOp {
+	return matchModTime(modTimeExpectation{
+		description: fmt.Sprintf("within %s of %s", tolerance, ref.Format(time.RFC3339Nano)),
+		match: func(modTime time.Time) bool {
+			diff := modTime.Sub(ref)
+			return diff <= tolerance && diff >= -tolerance
+		},
+	})
+}
+
+// MatchNewerThan is a [PathOp] that updates a [Manifest] so that the
+// modification time of the resource at path must be after ref, for example the
+// time when the test started.
+func MatchNewerThan(ref time.Time) PathOp {
+	return matchModTime(modTimeExpectation{
+		description: "newer than " + ref.Format(time.RFC3339Nano),
+		match:       func(modTime time.Time) bool { return modTime.After(ref) },
+	})
+}
+
+func matchModTime(expected modTimeExpectation) PathOp {
+	return func(path Path) error {
+		switch m := path.(type) {
+		case *filePath:
+			m.file.matchModTime = &expected
+		case *directoryPath:
+			m.directory.matchModTime = &expected
+		}
+		return nil
+	}
+}
+
+// MatchTotalSizeUnder is a [PathOp] that updates a [Manifest] so that the total
+// size of the files in the directory at path, and in all of its
+// subdirectories, must be less than size bytes.
+func MatchTotalSizeUnder(size int64) PathOp {
+	return addAggregate(func(actual *directory) []problem {
+		total, err := totalSize(actual)
+		switch {
+		case err != nil:
+			return []problem{errProblem("failed to read total size", err)}
+		case total >= size:
+			return []problem{notEqual(MismatchSize, "total size", fmt.Sprintf("under %d", size), total)}
+		}
+		return nil
+	})
+}
+
+// MatchEntryCount is a [PathOp] that updates a [Manifest] so that the directory
+// at path, and all of its subdirectories, must contain n entries in total.
+func MatchEntryCount(n int) PathOp {
+	return addAggregate(func(actual *directory) []problem {
+		if count := entryCount(actual); count != n {
+			return []problem{notEqual(MismatchCount, "entry count", n, count)}
+		}
+		return nil
+	})
+}
+
+func addAggregate(check func(actual *directory) []problem) PathOp {
+	return func(path Path) error {
+		if m, ok := path.(*directoryPath); ok {
+			m.directory.aggregates = append(m.directory.aggregates, check)
+		}
+		return nil
+	}
+}
+
+func entryCount(dir *directory) int {
+	count := 0
+	for _, entry := range dir.items {
+		count++
+		if sub, ok := entry.(*directory); ok {
+			count += entryCount(sub)
+		}
+	}
+	return count
+}
+
+// totalSize returns the total size of the files in dir. The content of files
+// which were not read from a directory is read into memory so that it can
+// still be compared.
+func totalSize(dir *directory) (int64, error) {
+	var total int64
+	for _, entry := range dir.items {
+		switch typed := entry.(type) {
+		case *directory:
+			size, err := totalSize(typed)
+			if err != nil {
+				return 0, err
+			}
+			total += size
+		case *file:
+			if typed.info != nil {
+				total += typed.info.Size()
+				continue
+			}
+			if typed.content == nil {
+				continue
+			}
+			content, err := io.ReadAll(typed.content)
+			typed.content.Close()
+			typed.content = io.NopCloser(bytes.NewReader(content))
+			if err != nil {
+				return 0, err
+			}
+			total += int64(len(content))
+		}
+	}
+	return total, nil
+}
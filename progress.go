@@ -0,0 +1,50 @@
+package fs
+
+import "sync"
+
+// Progress is the progress of a long operation, reported to the callback passed
+// to [WithProgress] or [FromDirWithProgress].
+type Progress struct {
+	// Entries is the number of files, directories, and symlinks which have
+	// been read or copied.
+	Entries int
+	// Bytes is the number of bytes of file content which have been read or
+	// copied.
+	Bytes int64
+}
+
+// WithProgress is a [CompareOption] which calls progress every time an entry is
+// read from the directory by [ManifestFromDir], [Equal], or [Compare], and every
+// time file content is read to compare it, so that a slow comparison can log
+// its progress. Entries are read concurrently, but progress is never called
+// concurrently.
+//
+//	fs.Equal(t, dir.Path(), expected, fs.WithProgress(func(p fs.Progress) {
+//		if p.Entries%10000 == 0 {
+//			t.Logf("read %d entries, %d bytes", p.Entries, p.Bytes)
+//		}
+//	}))
+func WithProgress(progress func(Progress)) CompareOption {
+	return func(o *compareOptions) {
+		o.progress = &progressReporter{report: progress}
+	}
+}
+
+// progressReporter accumulates the progress of an operation. A nil
+// progressReporter does nothing.
+type progressReporter struct {
+	mu       sync.Mutex
+	progress Progress
+	report   func(Progress)
+}
+
+func (p *progressReporter) add(entries int, bytes int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress.Entries += entries
+	p.progress.Bytes += bytes
+	p.report(p.progress)
+}
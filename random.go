@@ -0,0 +1,174 @@
+package fs
+
+import (
+	"math/rand"
+	"strconv"
+)
+
+// RandomTreeOption changes the shape of the tree created by [RandomTree].
+type RandomTreeOption func(*randomTreeOptions)
+
+type randomTreeOptions struct {
+	depth       int
+	fanOut      int
+	minFileSize int
+	maxFileSize int
+	dirRatio    float64
+}
+
+// WithTreeDepth is a [RandomTreeOption] which sets the maximum depth of nested
+// directories. The default is 3.
+func WithTreeDepth(depth int) RandomTreeOption {
+	return func(o *randomTreeOptions) {
+		o.depth = depth
+	}
+}
+
+// WithFanOut is a [RandomTreeOption] which sets the maximum number of entries
+// in each directory. The default is 5.
+func WithFanOut(n int) RandomTreeOption {
+	return func(o *randomTreeOptions) {
+		o.fanOut = n
+	}
+}
+
+// WithFileSizes is a [RandomTreeOption] which sets the range of file sizes in
+// bytes. Sizes are uniformly distributed between min and max inclusive. The
+// default is 0 to 1024.
+func WithFileSizes(min, max int) RandomTreeOption {
+	return func(o *randomTreeOptions) {
+		o.minFileSize = min
+		o.maxFileSize = max
+	}
+}
+
+// WithDirRatio is a [RandomTreeOption] which sets the probability that an entry
+// is a directory instead of a file. The default is 0.3.
+func WithDirRatio(ratio float64) RandomTreeOption {
+	return func(o *randomTreeOptions) {
+		o.dirRatio = ratio
+	}
+}
+
+// RandomTree returns a [PathOp] which creates a random tree of files and
+// directories. The tree is generated from seed, so the same seed and options
+// always produce the same tree. The PathOp can be used with both [NewDir] and
+// [Expected] to create a directory and the [Manifest] which matches it, for
+// property based or stress testing of code which walks a directory.
+//
+//	tree := fs.RandomTree(seed, fs.WithTreeDepth(5))
+//	dir := fs.NewDir(t, "random", tree)
+//	// ... copy dir.Path() to dest
+//	assert.Assert(t, fs.Equal(dest, fs.Expected(t, tree)))
+func RandomTree(seed int64, opts ...RandomTreeOption) PathOp {
+	o := &randomTreeOptions{depth: 3, fanOut: 5, maxFileSize: 1024, dirRatio: 0.3}
+	for _, opt := range opts {
+		opt(o)
+	}
+	ops := randomEntries(rand.New(rand.NewSource(seed)), o, o.depth)
+	return func(path Path) error {
+		return applyPathOps(path, ops)
+	}
+}
+
+const randomNameChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+func randomEntries(r *rand.Rand, o *randomTreeOptions, depth int) []PathOp {
+	var ops []PathOp
+	for i := r.Intn(o.fanOut + 1); i > 0; i-- {
+		// The suffix keeps the names in a directory unique.
+		name := randomString(r, 1+r.Intn(8)) + "-" + strconv.Itoa(i)
+		if depth > 0 && r.Float64() < o.dirRatio {
+			ops = append(ops, WithDir(name, randomEntries(r, o, depth-1)...))
+			continue
+		}
+		size := o.minFileSize
+		if o.maxFileSize > o.minFileSize {
+			size += r.Intn(o.maxFileSize - o.minFileSize + 1)
+		}
+		ops = append(ops, WithFile(name, randomString(r, size)))
+	}
+	return ops
+}
+
+func randomString(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = randomNameChars[r.Intn(len(randomNameChars))]
+	}
+	return string(b)
+}
+
+// FromFuzzInput returns a [PathOp] which creates a tree of files and
+// directories decoded from data, so that a fuzz target can test code which reads
+// a directory with trees derived from the fuzzing corpus. Every input decodes to
+// a valid tree, and the same input always decodes to the same tree. The PathOp
+// can be used with both [NewDir] and [Expected].
+//
+//	f.Fuzz(func(t *testing.T, data []byte) {
+//		tree := fs.FromFuzzInput(data)
+//		dir := fs.DirFromPath(t, t.TempDir(), tree)
+//		// ... archive and extract dir.Path() to dest
+//		assert.Assert(t, fs.Equal(dest, fs.Expected(t, tree, fs.MatchAnyFileMode)))
+//	})
+func FromFuzzInput(data []byte) PathOp {
+	d := &fuzzDecoder{data: data}
+	ops := d.entries(0)
+	return func(path Path) error {
+		return applyPathOps(path, ops)
+	}
+}
+
+// maxFuzzDepth limits the nesting of directories decoded from a fuzz input.
+const maxFuzzDepth = 8
+
+// fuzzDecoder decodes a tree from a fuzz input. Each entry starts with a byte
+// which selects a file, a directory, or the end of the current directory. The
+// name and content of an entry are prefixed by their length.
+type fuzzDecoder struct {
+	data []byte
+}
+
+func (d *fuzzDecoder) next() byte {
+	if len(d.data) == 0 {
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *fuzzDecoder) bytes(n int) []byte {
+	n = min(n, len(d.data))
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *fuzzDecoder) entries(depth int) []PathOp {
+	var ops []PathOp
+	for i := 0; len(d.data) > 0; i++ {
+		kind := d.next() % 4
+		if kind == 3 {
+			return ops
+		}
+
+		// Names only use lowercase characters so that they are valid, and do
+		// not collide, on case insensitive filesystems. The suffix keeps the
+		// names in a directory unique.
+		raw := d.bytes(int(d.next()%8) + 1)
+		name := make([]byte, len(raw))
+		for j, b := range raw {
+			name[j] = randomNameChars[int(b)%len(randomNameChars)]
+		}
+		entryName := string(name) + "-" + strconv.Itoa(i)
+
+		if kind == 2 && depth < maxFuzzDepth {
+			ops = append(ops, WithDir(entryName, d.entries(depth+1)...))
+			continue
+		}
+		content := append([]byte{}, d.bytes(int(d.next()))...)
+		ops = append(ops, WithFile(entryName, "", WithBytes(content)))
+	}
+	return ops
+}
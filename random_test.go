@@ -0,0 +1,33 @@
+package fs_test
+
+import (
+	"testing"
+
+	fs "github.com/goslogan/assertfs"
+	"gotest.tools/v3/assert"
+)
+
+func TestRandomTree(t *testing.T) {
+	tree := fs.RandomTree(42, fs.WithTreeDepth(4), fs.WithFanOut(6), fs.WithFileSizes(1, 64))
+	dir := fs.NewDir(t, t.Name(), tree)
+	defer dir.Remove()
+	assert.Assert(t, fs.Equal(t, dir.Path(), fs.Expected(t, tree)))
+
+	same := fs.NewDir(t, t.Name(), fs.RandomTree(42, fs.WithTreeDepth(4), fs.WithFanOut(6), fs.WithFileSizes(1, 64)))
+	defer same.Remove()
+	assert.Equal(t, fs.Tree(dir.Path()), fs.Tree(same.Path()))
+
+	other := fs.NewDir(t, t.Name(), fs.RandomTree(7, fs.WithTreeDepth(4), fs.WithFanOut(6), fs.WithFileSizes(1, 64)))
+	defer other.Remove()
+	assert.Assert(t, fs.Tree(dir.Path()) != fs.Tree(other.Path()))
+}
+
+func FuzzFromFuzzInput(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte("\x00\x02ab\x03xyz\x02\x01d\x00\x00\x01e\x05hello\x03\x00\x00f\x00"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tree := fs.FromFuzzInput(data)
+		dir := fs.DirFromPath(t, t.TempDir(), tree)
+		assert.Assert(t, fs.Equal(t, dir.Path(), fs.Expected(t, tree, fs.MatchAnyFileMode)))
+	})
+}
@@ -0,0 +1,20 @@
+package fs
+
+import "syscall"
+
+// remountReadOnly bind mounts path on itself, and remounts the bind mount
+// read-only.
+func remountReadOnly(path string) error {
+	if err := syscall.Mount(path, path, "", syscall.MS_BIND, ""); err != nil {
+		return err
+	}
+	err := syscall.Mount("", path, "", syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY, "")
+	if err != nil {
+		_ = syscall.Unmount(path, 0)
+	}
+	return err
+}
+
+func unmountReadOnly(path string) error {
+	return syscall.Unmount(path, 0)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package fs
+
+import "errors"
+
+func remountReadOnly(path string) error {
+	return errors.New("remounting is not supported on this platform")
+}
+
+func unmountReadOnly(path string) error {
+	return nil
+}
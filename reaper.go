@@ -0,0 +1,173 @@
+package fs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// registryEnabled is set by ReapStale, and enables the registry of the paths
+// created by this package.
+var registryEnabled atomic.Bool
+
+// ReapStale removes the temporary files and directories which were created by
+// an earlier run of the tests, at least maxAge ago, and were never removed,
+// for example because the test binary crashed or was killed. It also enables
+// the registry which records the paths created by this package, so that a
+// later run can remove them. ReapStale should be called from TestMain before
+// the tests are run:
+//
+//	func TestMain(m *testing.M) {
+//		if err := fs.ReapStale(24 * time.Hour); err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//		}
+//		os.Exit(m.Run())
+//	}
+//
+// The registry is a directory in [os.TempDir] which can only be used by the
+// current user. Paths which were kept by a [CleanupPolicy] are also removed
+// once they are older than maxAge. Paths which are still used by a running
+// process, paths outside of os.TempDir, and paths which were not named by this
+// package are never removed.
+func ReapStale(maxAge time.Duration) error {
+	registryEnabled.Store(true)
+	if err := checkRegistryDir(); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	entries, err := os.ReadDir(registryDir())
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		entryPath := filepath.Join(registryDir(), entry.Name())
+		content, err := os.ReadFile(entryPath)
+		if err != nil {
+			continue
+		}
+		owner, path, ok := parseRegistryEntry(string(content))
+		switch {
+		case ok && processAlive(owner.pid, owner.start):
+			// The path may still be used by the process which created it.
+			continue
+		case ok && isReapable(path):
+			dir := &Dir{path: path}
+			if err := dir.RemoveE(); err != nil {
+				return fmt.Errorf("failed to remove stale %s: %w", path, err)
+			}
+		}
+		if err := os.Remove(entryPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// reapableName matches the names of the files and directories created by this
+// package, which end with the random suffix added by os.MkdirTemp and
+// os.CreateTemp, or with the counter added by WithDeterministicName.
+var reapableName = regexp.MustCompile(`^.+-[0-9]+$`)
+
+// isReapable returns true if path can be removed by ReapStale. Paths outside of
+// os.TempDir, and paths which were not named by this package, are never
+// removed, even if an entry in the registry names them.
+func isReapable(path string) bool {
+	if !filepath.IsAbs(path) || !reapableName.MatchString(filepath.Base(path)) {
+		return false
+	}
+	rel, err := filepath.Rel(os.TempDir(), path)
+	if err != nil || rel == "." || rel == ".." {
+		return false
+	}
+	return !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// registryDir returns the directory of the registry. Each user has their own
+// registry, which only they can read and write.
+func registryDir() string {
+	return filepath.Join(os.TempDir(), registryName())
+}
+
+// checkRegistryDir returns an error if the registry is not a directory which
+// is owned by the current user and can only be used by them.
+func checkRegistryDir() error {
+	info, err := os.Lstat(registryDir())
+	switch {
+	case err != nil:
+		return err
+	case !info.IsDir():
+		return fmt.Errorf("registry %s is not a directory", registryDir())
+	case !ownedByCurrentUser(info):
+		return fmt.Errorf("registry %s is not owned by the current user", registryDir())
+	}
+	return nil
+}
+
+func registryEntry(path string) string {
+	return filepath.Join(registryDir(), fmt.Sprintf("%x", sha256.Sum256([]byte(path))))
+}
+
+// registryOwner identifies the process which created a path in the registry.
+// start is the time the process was started, in a format which depends on the
+// platform, or is empty if it is not known. It is used to tell the process
+// apart from a later process with the same pid.
+type registryOwner struct {
+	pid   int
+	start string
+}
+
+var currentOwner = sync.OnceValue(func() registryOwner {
+	pid := os.Getpid()
+	return registryOwner{pid: pid, start: processStart(pid)}
+})
+
+func formatRegistryEntry(owner registryOwner, path string) string {
+	return strconv.Itoa(owner.pid) + "\n" + owner.start + "\n" + path
+}
+
+func parseRegistryEntry(content string) (registryOwner, string, bool) {
+	fields := strings.SplitN(content, "\n", 3)
+	if len(fields) != 3 {
+		return registryOwner{}, "", false
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil || pid <= 0 {
+		return registryOwner{}, "", false
+	}
+	return registryOwner{pid: pid, start: fields[1]}, fields[2], true
+}
+
+// register records path in the registry, if it is enabled.
+func register(path string) {
+	if !registryEnabled.Load() {
+		return
+	}
+	writeRegistryEntry(currentOwner(), path)
+}
+
+func writeRegistryEntry(owner registryOwner, path string) {
+	if err := os.MkdirAll(registryDir(), 0700); err != nil || checkRegistryDir() != nil {
+		return
+	}
+	_ = os.WriteFile(registryEntry(path), []byte(formatRegistryEntry(owner, path)), 0600)
+}
+
+// unregister removes path from the registry, if it is enabled.
+func unregister(path string) {
+	if registryEnabled.Load() {
+		_ = os.Remove(registryEntry(path))
+	}
+}
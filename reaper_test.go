@@ -0,0 +1,75 @@
+package fs
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestReapStale(t *testing.T) {
+	assert.NilError(t, ReapStale(time.Hour))
+	defer registryEnabled.Store(false)
+
+	removed := NewDir(t, t.Name())
+	_, err := os.Stat(registryEntry(removed.Path()))
+	assert.NilError(t, err)
+	removed.Remove()
+	_, err = os.Stat(registryEntry(removed.Path()))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// A directory which was never removed, as if the test binary crashed.
+	exited := exec.Command(os.Args[0], "-test.run=^$")
+	assert.NilError(t, exited.Run())
+	crashed := registryOwner{pid: exited.Process.Pid}
+	stale, err := os.MkdirTemp("", "stale-")
+	assert.NilError(t, err)
+	writeRegistryEntry(crashed, stale)
+	recent, err := os.MkdirTemp("", "recent-")
+	assert.NilError(t, err)
+	writeRegistryEntry(crashed, recent)
+	defer (&Dir{path: recent}).Remove()
+	live, err := os.MkdirTemp("", "live-")
+	assert.NilError(t, err)
+	register(live)
+	defer (&Dir{path: live}).Remove()
+	// A directory which was not named by this package.
+	unnamed := filepath.Join(t.TempDir(), "unnamed")
+	assert.NilError(t, os.Mkdir(unnamed, 0700))
+	writeRegistryEntry(crashed, unnamed)
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, path := range []string{stale, live, unnamed} {
+		assert.NilError(t, os.Chtimes(registryEntry(path), old, old))
+	}
+	assert.NilError(t, ReapStale(time.Hour))
+
+	_, err = os.Stat(stale)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(registryEntry(stale))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(recent)
+	assert.NilError(t, err)
+	_, err = os.Stat(live)
+	assert.NilError(t, err)
+	_, err = os.Stat(registryEntry(live))
+	assert.NilError(t, err)
+	_, err = os.Stat(unnamed)
+	assert.NilError(t, err)
+}
+
+func TestIsReapable(t *testing.T) {
+	assert.Assert(t, isReapable(tempPath("TestDir-1234")))
+	assert.Assert(t, isReapable(tempPath("TestDir", "001", "dir-1")))
+	assert.Assert(t, !isReapable(os.TempDir()))
+	assert.Assert(t, !isReapable(tempPath("home")))
+	assert.Assert(t, !isReapable(tempPath("..", "dir-1234")))
+	assert.Assert(t, !isReapable("dir-1234"))
+}
+
+func tempPath(elem ...string) string {
+	return filepath.Join(append([]string{os.TempDir()}, elem...)...)
+}
@@ -0,0 +1,50 @@
+//go:build !windows
+// +build !windows
+
+package fs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func registryName() string {
+	return "fstest-registry-" + strconv.Itoa(os.Getuid())
+}
+
+func ownedByCurrentUser(info os.FileInfo) bool {
+	statT, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(statT.Uid) == os.Getuid() && info.Mode().Perm()&0077 == 0
+}
+
+// processAlive returns true if a process with pid is running, and was started
+// at start. The process is assumed to be alive when it can not be checked.
+func processAlive(pid int, start string) bool {
+	if err := syscall.Kill(pid, 0); err != nil && err != syscall.EPERM {
+		return false
+	}
+	if actual := processStart(pid); start != "" && actual != "" && actual != start {
+		return false
+	}
+	return true
+}
+
+// processStart returns the start time of the process from /proc, or an empty
+// string on platforms without /proc.
+func processStart(pid int) string {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return ""
+	}
+	// The command, which is the second field, is in parentheses and may
+	// contain spaces. starttime is the 22nd field.
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	if len(fields) < 20 {
+		return ""
+	}
+	return fields[19]
+}
@@ -0,0 +1,27 @@
+package fs
+
+import "os"
+
+// The temporary directory is not shared by users on windows.
+func registryName() string {
+	return "fstest-registry"
+}
+
+func ownedByCurrentUser(info os.FileInfo) bool {
+	return true
+}
+
+// processAlive returns true if a process with pid is running. The start time
+// is not known on windows.
+func processAlive(pid int, start string) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
+
+func processStart(pid int) string {
+	return ""
+}
@@ -0,0 +1,114 @@
+package fs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// RemoteFS provides access to a directory which is not on the local
+// filesystem, such as a directory on a remote host. Paths are slash separated.
+//
+// ReadDir must not follow symlinks, so that symlinks are reported as symlinks.
+// If the [os.FileInfo] returned by RemoteFS implements RemoteOwner the
+// ownership of entries is included in the manifest.
+//
+// See [NewSFTPRemote] for an implementation which uses SFTP.
+type RemoteFS interface {
+	Stat(path string) (os.FileInfo, error)
+	ReadDir(path string) ([]os.FileInfo, error)
+	ReadLink(path string) (string, error)
+	Open(path string) (io.ReadCloser, error)
+}
+
+// RemoteOwner may be implemented by the [os.FileInfo] returned by a [RemoteFS]
+// to report the ownership of an entry.
+type RemoteOwner interface {
+	Owner() (uid, gid uint32)
+}
+
+// ManifestFromRemote creates a [Manifest] by reading the directory at path using
+// rfs. ManifestFromRemote can be used with [EqualManifest] to compare a remote
+// directory to an expected structure.
+func ManifestFromRemote(t assert.TestingT, rfs RemoteFS, path string) Manifest {
+	if ht, ok := t.(helperT); ok {
+		ht.Helper()
+	}
+
+	manifest, err := manifestFromRemote(rfs, path)
+	assert.Nil(t, err)
+	return manifest
+}
+
+func manifestFromRemote(rfs RemoteFS, path string) (Manifest, error) {
+	info, err := rfs.Stat(path)
+	switch {
+	case err != nil:
+		return Manifest{}, err
+	case !info.IsDir():
+		return Manifest{}, fmt.Errorf("path %s must be a directory", path)
+	}
+
+	directory, err := newRemoteDirectory(rfs, path, info)
+	return Manifest{root: directory}, err
+}
+
+func newRemoteDirectory(rfs RemoteFS, dirPath string, info os.FileInfo) (*directory, error) {
+	items := make(map[string]dirEntry)
+	children, err := rfs.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		fullPath := path.Join(dirPath, child.Name())
+		items[child.Name()], err = getTypedRemoteResource(rfs, fullPath, child)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &directory{
+		resource:      newResourceFromRemoteInfo(info),
+		items:         items,
+		filepathGlobs: make(map[string]*filePath),
+	}, nil
+}
+
+func getTypedRemoteResource(rfs RemoteFS, path string, info os.FileInfo) (dirEntry, error) {
+	switch {
+	case info.IsDir():
+		return newRemoteDirectory(rfs, path, info)
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := rfs.ReadLink(path)
+		if err != nil {
+			return nil, err
+		}
+		return &symlink{
+			resource: newResourceFromRemoteInfo(info),
+			target:   target,
+		}, nil
+	default:
+		content, err := rfs.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return &file{
+			resource: newResourceFromRemoteInfo(info),
+			content:  content,
+		}, nil
+	}
+}
+
+func newResourceFromRemoteInfo(info os.FileInfo) resource {
+	owner, ok := info.(RemoteOwner)
+	if !ok {
+		res := newResource(info.Mode())
+		res.modTime = info.ModTime()
+		return res
+	}
+	uid, gid := owner.Owner()
+	return resource{mode: info.Mode(), uid: uid, gid: gid, modTime: info.ModTime()}
+}
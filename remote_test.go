@@ -0,0 +1,54 @@
+package fs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// localRemote is a RemoteFS which reads files from the local filesystem.
+type localRemote struct{}
+
+func (localRemote) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(filepath.FromSlash(path))
+}
+
+func (localRemote) ReadDir(path string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(filepath.FromSlash(path))
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (localRemote) ReadLink(path string) (string, error) {
+	return os.Readlink(filepath.FromSlash(path))
+}
+
+func (localRemote) Open(path string) (io.ReadCloser, error) {
+	return os.Open(filepath.FromSlash(path))
+}
+
+func TestManifestFromRemote(t *testing.T) {
+	ops := []PathOp{
+		WithFile("1", "content 1", WithMode(0600)),
+		WithDir("a",
+			WithFile("2", "content 2")),
+	}
+	dir := NewDir(t, t.Name(), append(ops, WithSymlink("link", "1"))...)
+
+	expected := Expected(t, append(ops, WithSymlink("link", dir.Join("1")))...)
+	manifest := ManifestFromRemote(t, localRemote{}, filepath.ToSlash(dir.Path()))
+	assert.True(t, EqualManifest(t, manifest, expected))
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+// +build !windows
+
+package fs
+
+func isSharingViolation(err error) bool {
+	return false
+}
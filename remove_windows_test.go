@@ -0,0 +1,30 @@
+package fs
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDirRemoveRetriesSharingViolation(t *testing.T) {
+	dir := NewDir(t, t.Name(), WithFile("file1", "content"))
+
+	name, err := syscall.UTF16PtrFromString(dir.Join("file1"))
+	assert.NilError(t, err)
+	// Open the file without FILE_SHARE_DELETE so that it can not be removed
+	// until it is closed.
+	handle, err := syscall.CreateFile(name, syscall.GENERIC_READ, syscall.FILE_SHARE_READ,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	assert.NilError(t, err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		syscall.CloseHandle(handle)
+	}()
+
+	assert.NilError(t, dir.RemoveE())
+	_, err = os.Stat(dir.Path())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -2,17 +2,24 @@ package fs
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	iofs "io/fs"
 	"os"
+	"os/user"
+	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/pmezard/go-difflib/difflib"
 	"github.com/stretchr/testify/assert"
-	"gotest.tools/assert/cmp"
 )
 
 // Equal compares a directory to the expected structured described by a manifest
@@ -20,24 +27,64 @@ import (
 // will contain all the differences between the directory structure and the
 // expected structure defined by the [Manifest].
 //
+// The [CompareOption] opts change how the directory is compared. Use [Compare]
+// to inspect the differences without failing the test.
+func Equal(t *testing.T, path string, expected Manifest, opts ...CompareOption) bool {
+	return assertResult(t, "failed to read directory", Compare(path, expected, opts...))
+}
 
-func Equal(t *testing.T, path string, expected Manifest) bool {
+// EqualContext compares a directory to the expected structure described by a
+// manifest, like [Equal], and fails the test if ctx is done before the
+// comparison finishes, so that comparing a very large directory can be stopped
+// by the deadline of the test.
+//
+//	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+//	defer cancel()
+//	fs.EqualContext(ctx, t, dir.Path(), expected)
+func EqualContext(ctx context.Context, t *testing.T, path string, expected Manifest, opts ...CompareOption) bool {
+	return assertResult(t, "failed to read directory", CompareContext(ctx, path, expected, opts...))
+}
 
-	actual, err := manifestFromDir(path)
-	if err != nil {
-		return assert.Fail(t, "failed to read directory", err)
-	}
+// EqualManifest compares a [Manifest] to the expected structure described by
+// another manifest, and returns success if they match. EqualManifest can be used
+// with [ManifestFromFS] to compare filesystems which are not on disk.
+func EqualManifest(t *testing.T, actual, expected Manifest, opts ...CompareOption) bool {
+	return assertResult(t, "failed to compare manifest", CompareManifest(actual, expected, opts...))
+}
+
+// Contains compares a directory to the expected structure described by a
+// manifest, and returns success if every entry in the manifest matches. Entries
+// in the directory which are not in the manifest are ignored, see
+// [WithExtraFiles].
+func Contains(t *testing.T, path string, expected Manifest, opts ...CompareOption) bool {
+	return Equal(t, path, expected, append(opts, WithExtraFiles())...)
+}
 
-	failures := eqDirectory(string(os.PathSeparator), expected.root, actual.root)
-	if len(failures) == 0 {
+func assertResult(t *testing.T, reason string, result Result) bool {
+	switch {
+	case result.Err != nil:
+		return assert.Fail(t, reason, result.Err)
+	case result.Success():
 		return true
 	}
+	return assert.Fail(t, result.FailureMessage())
+}
 
-	return func() cmp.Result {
-
-		msg := fmt.Sprintf("directory %s does not match expected:\n", path)
-		return cmp.ResultFailure(msg + formatFailures(failures))
+// EqualFS compares a directory to the tree at root in fsys, and returns success
+// if the structure and content of every file matches. EqualFS can be used to
+// verify generated output against golden trees stored in an [embed.FS].
+//
+// File modes and ownership are not compared, see [FromFS].
+func EqualFS(t *testing.T, path string, fsys iofs.FS, root string, opts ...CompareOption) bool {
+	sub, err := iofs.Sub(fsys, root)
+	if err != nil {
+		return assert.Fail(t, "failed to read expected filesystem", err)
+	}
+	ops, err := opsFromFS(sub, ".")
+	if err != nil {
+		return assert.Fail(t, "failed to read expected filesystem", err)
 	}
+	return Equal(t, path, Expected(t, ops...), opts...)
 }
 
 type failure struct {
@@ -45,52 +92,169 @@ type failure struct {
 	problems []problem
 }
 
-type problem string
+type problem struct {
+	kind MismatchKind
+	// name is the name of the entry when the problem is reported by the
+	// directory which contains the entry.
+	name     string
+	expected string
+	actual   string
+	message  string
+}
+
+func (p problem) String() string {
+	return p.message
+}
 
-func notEqual(property string, x, y interface{}) problem {
-	return problem(fmt.Sprintf("%s: expected %s got %s", property, x, y))
+func notEqual(kind MismatchKind, property string, x, y interface{}) problem {
+	return problem{
+		kind:     kind,
+		expected: fmt.Sprint(x),
+		actual:   fmt.Sprint(y),
+		message:  fmt.Sprintf("%s: expected %v got %v", property, x, y),
+	}
+}
+
+func typeProblem(name string, x, y string) problem {
+	p := notEqual(MismatchType, name, x, y)
+	p.name = name
+	return p
 }
 
 func errProblem(reason string, err error) problem {
-	return problem(fmt.Sprintf("%s: %s", reason, err))
+	return problem{kind: MismatchError, message: fmt.Sprintf("%s: %s", reason, err)}
+}
+
+func existenceProblem(kind MismatchKind, filename string, msgAndArgs ...interface{}) problem {
+	return problem{kind: kind, name: filename, message: filename + ": " + formatMessage(msgAndArgs...)}
+}
+
+func missingProblem(name string, entry dirEntry) problem {
+	p := existenceProblem(MismatchMissing, name, "expected %s to exist", entry.Type())
+	p.expected = entry.Type()
+	return p
+}
+
+func presentProblem(name string, entry dirEntry) problem {
+	p := existenceProblem(MismatchUnexpected, name, "expected %s to be missing", entry.Type())
+	p.actual = entry.Type()
+	return p
+}
+
+func unexpectedProblem(name string, entry dirEntry) problem {
+	p := existenceProblem(MismatchUnexpected, name, "unexpected %s", entry.Type())
+	p.actual = entry.Type()
+	return p
 }
 
-func existenceProblem(filename string, msgAndArgs ...interface{}) problem {
-	return problem(filename + ": " + formatMessage(msgAndArgs...))
+func contentProblem(msgAndArgs ...interface{}) problem {
+	return problem{kind: MismatchContent, message: "content: " + formatMessage(msgAndArgs...)}
 }
 
-func eqResource(x, y resource) []problem {
+func eqResource(opts *compareOptions, x, y resource) []problem {
 	var p []problem
-	if x.uid != y.uid {
-		p = append(p, notEqual("uid", x.uid, y.uid))
+	switch {
+	case opts.ignoreOwnership:
+	case x.owner != "":
+		if owner := lookupUser(y.uid); owner != x.owner {
+			p = append(p, notEqual(MismatchUID, "owner", x.owner, owner))
+		}
+	case x.uid != y.uid:
+		p = append(p, notEqual(MismatchUID, "uid", x.uid, y.uid))
 	}
-	if x.gid != y.gid {
-		p = append(p, notEqual("gid", x.gid, y.gid))
+	switch {
+	case opts.ignoreOwnership:
+	case x.group != "":
+		if group := lookupGroup(y.gid); group != x.group {
+			p = append(p, notEqual(MismatchGID, "group", x.group, group))
+		}
+	case x.gid != y.gid:
+		p = append(p, notEqual(MismatchGID, "gid", x.gid, y.gid))
 	}
-	if x.mode != anyFileMode && x.mode != y.mode {
-		p = append(p, notEqual("mode", x.mode, y.mode))
+	if x.matchModTime != nil && !x.matchModTime.match(y.modTime) {
+		p = append(p, notEqual(MismatchModTime, "mtime", x.matchModTime.description, y.modTime.Format(time.RFC3339Nano)))
+	}
+	switch {
+	case opts.ignoreModes:
+	case x.modeMask != 0:
+		if y.mode&x.modeMask != x.mode&x.modeMask {
+			property := fmt.Sprintf("mode (mask %04o)", uint32(x.modeMask))
+			p = append(p, notEqual(MismatchMode, property, x.mode&x.modeMask, y.mode&x.modeMask))
+		}
+	case x.mode != anyFileMode && x.mode != y.mode:
+		p = append(p, notEqual(MismatchMode, "mode", x.mode, y.mode))
 	}
 	return p
 }
 
+// lookupUser returns the name of the user with uid, or the uid if the user
+// does not exist.
+func lookupUser(uid uint32) string {
+	id := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(id); err == nil {
+		return u.Username
+	}
+	return id
+}
+
+// lookupGroup returns the name of the group with gid, or the gid if the group
+// does not exist.
+func lookupGroup(gid uint32) string {
+	id := strconv.FormatUint(uint64(gid), 10)
+	if g, err := user.LookupGroupId(id); err == nil {
+		return g.Name
+	}
+	return id
+}
+
 func removeCarriageReturn(in []byte) []byte {
 	return bytes.Replace(in, []byte("\r\n"), []byte("\n"), -1)
 }
 
-func eqFile(x, y *file) []problem {
-	p := eqResource(x.resource, y.resource)
+var horizontalSpace = regexp.MustCompile(`[ \t]+`)
+
+func collapseWhitespace(in []byte) []byte {
+	lines := bytes.Split(in, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.TrimSpace(horizontalSpace.ReplaceAll(line, []byte(" ")))
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+func eqFile(opts *compareOptions, path string, x, y *file) []problem {
+	p := eqResource(opts, x.resource, y.resource)
+	if x.sameFileAs != "" {
+		p = append(p, opts.eqSameFile(x.sameFileAs, y)...)
+	}
+	if opts.sparseLayout {
+		p = append(p, eqExtents(x.extents, y.extents)...)
+	}
 
 	switch {
+	case len(x.matchers) > 0:
+		return append(p, eqMatchers(opts, path, x, y)...)
+	case x.readerFunc != nil && y.content != nil:
+		defer y.content.Close()
+		if err := x.readerFunc(y.content); err != nil {
+			p = append(p, contentProblem(err.Error()))
+		}
+		return p
 	case x.content == nil:
-		p = append(p, existenceProblem("content", "expected content is nil"))
+		p = append(p, contentProblem("expected content is nil"))
 		return p
 	case x.content == anyFileContent:
 		return p
 	case y.content == nil:
-		p = append(p, existenceProblem("content", "actual content is nil"))
+		p = append(p, contentProblem("actual content is nil"))
 		return p
 	}
 
+	if opts.streamable(path, x, y) {
+		defer x.content.Close()
+		defer y.content.Close()
+		return append(p, opts.eqContent(x, y)...)
+	}
+
 	xContent, xErr := io.ReadAll(x.content)
 	defer x.content.Close()
 	yContent, yErr := io.ReadAll(y.content)
@@ -100,42 +264,124 @@ func eqFile(x, y *file) []problem {
 		p = append(p, errProblem("failed to read expected content", xErr))
 	}
 	if yErr != nil {
-		p = append(p, errProblem("failed to read actual content", xErr))
+		p = append(p, errProblem("failed to read actual content", yErr))
 	}
 	if xErr != nil || yErr != nil {
 		return p
 	}
 
+	xContent = opts.transform(path, xContent)
+	yContent = opts.transform(path, yContent)
+
 	if x.compareContentFunc != nil {
 		r := x.compareContentFunc(yContent)
 		if !r.Success() {
-			p = append(p, existenceProblem("content", r.FailureMessage()))
+			p = append(p, contentProblem(r.FailureMessage()))
+		}
+		return p
+	}
+	if x.contentFunc != nil {
+		if err := x.contentFunc(relativePath(path), yContent); err != nil {
+			p = append(p, contentProblem(err.Error()))
 		}
 		return p
 	}
 
-	if x.ignoreCariageReturn || y.ignoreCariageReturn {
+	textCR := opts.ignoreCarriageReturn && !isBinary(xContent) && !isBinary(yContent)
+	if x.ignoreCariageReturn || y.ignoreCariageReturn || textCR {
 		xContent = removeCarriageReturn(xContent)
 		yContent = removeCarriageReturn(yContent)
 	}
+	if x.ignoreTrailingNewline || y.ignoreTrailingNewline {
+		xContent = bytes.TrimSuffix(xContent, []byte("\n"))
+		yContent = bytes.TrimSuffix(yContent, []byte("\n"))
+	}
+	if x.ignoreWhitespace || y.ignoreWhitespace {
+		xContent = collapseWhitespace(xContent)
+		yContent = collapseWhitespace(yContent)
+	}
 
-	if !bytes.Equal(xContent, yContent) {
-		p = append(p, diffContent(xContent, yContent))
+	equal := bytes.Equal
+	if compare := opts.comparer(path); compare != nil {
+		equal = compare
+	}
+	if !equal(xContent, yContent) {
+		p = append(p, diffContent(opts, xContent, yContent))
 	}
 	return p
 }
 
-func diffContent(x, y []byte) problem {
-	diff := format.UnifiedDiff(format.DiffConfig{
-		A:    string(x),
-		B:    string(y),
-		From: "expected",
-		To:   "actual",
-	})
+// eqSameFile compares the identity of the actual file y to the actual file at
+// the slash separated path target.
+func (o *compareOptions) eqSameFile(target string, y *file) []problem {
+	other, ok := lookupPath(o.actualRoot, target).(*file)
+	switch {
+	case !ok:
+		return []problem{notEqual(MismatchLink, "link", "same file as "+target, "no file at "+target)}
+	case other.info == nil || y.info == nil:
+		return []problem{errProblem("failed to compare link", fmt.Errorf("file identity is unknown"))}
+	case !os.SameFile(other.info, y.info):
+		return []problem{notEqual(MismatchLink, "link", "same file as "+target, "different file")}
+	}
+	return nil
+}
+
+// lookupPath returns the entry at the slash separated path relative to root,
+// or nil if it does not exist.
+func lookupPath(root *directory, target string) dirEntry {
+	var entry dirEntry = root
+	for _, name := range strings.Split(strings.Trim(target, "/"), "/") {
+		dir, ok := entry.(*directory)
+		if !ok || dir == nil {
+			return nil
+		}
+		entry = dir.items[name]
+	}
+	return entry
+}
+
+func diffContent(opts *compareOptions, x, y []byte) problem {
+	var diff string
+	if isBinary(x) || isBinary(y) {
+		diff = hexDiff(x, y, opts.binaryDiffRanges)
+	} else {
+		diff = unifiedDiff(string(x), string(y), opts.diffContext)
+	}
 	// Remove the trailing newline in the diff. A trailing newline is always
 	// added to a problem by formatFailures.
-	diff = strings.TrimSuffix(diff, "\n")
-	return problem("content:\n" + indent(diff, "    "))
+	diff = truncateLines(strings.TrimSuffix(diff, "\n"), opts.maxDiffLines)
+	return problem{
+		kind:     MismatchContent,
+		expected: string(x),
+		actual:   string(y),
+		message:  "content:\n" + indent(diff, "    "),
+	}
+}
+
+// unifiedDiff returns a unified diff of the lines in x and y, with context
+// lines of unchanged content around each change.
+func unifiedDiff(x, y string, context int) string {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(x),
+		B:        difflib.SplitLines(y),
+		FromFile: "expected",
+		ToFile:   "actual",
+		Context:  context,
+	})
+	if err != nil {
+		return fmt.Sprintf("failed to diff content: %s", err)
+	}
+	return diff
+}
+
+// truncateLines returns the first limit lines of s, followed by a line with
+// the number of lines removed. s is returned unmodified if limit is 0.
+func truncateLines(s string, limit int) string {
+	lines := strings.SplitAfter(s, "\n")
+	if limit <= 0 || len(lines) <= limit {
+		return s
+	}
+	return strings.Join(lines[:limit], "") + fmt.Sprintf("... and %d more lines", len(lines)-limit)
 }
 
 func indent(s, prefix string) string {
@@ -147,8 +393,8 @@ func indent(s, prefix string) string {
 	return buf.String()
 }
 
-func eqSymlink(x, y *symlink) []problem {
-	p := eqResource(x.resource, y.resource)
+func eqSymlink(opts *compareOptions, x, y *symlink) []problem {
+	p := eqResource(opts, x.resource, y.resource)
 	xTarget := x.target
 	yTarget := y.target
 	if runtime.GOOS == "windows" {
@@ -156,51 +402,122 @@ func eqSymlink(x, y *symlink) []problem {
 		yTarget = strings.ToLower(yTarget)
 	}
 	if xTarget != yTarget {
-		p = append(p, notEqual("target", x.target, y.target))
+		p = append(p, notEqual(MismatchTarget, "target", x.target, y.target))
 	}
 	return p
 }
 
-func eqDirectory(path string, x, y *directory) []failure {
-	p := eqResource(x.resource, y.resource)
+// eqDirectory compares the directories x and y. recursive are the globs with a
+// ** pattern which were declared by the parent directories of x.
+func eqDirectory(opts *compareOptions, path string, x, y *directory, recursive []recursiveGlob) []failure {
+	p := eqResource(opts, x.resource, y.resource)
+	for _, aggregate := range x.aggregates {
+		p = append(p, aggregate(y)...)
+	}
+	if x.anyContents || opts.beyondMaxDepth(path) {
+		return maybeAppendFailure(nil, path, p)
+	}
 	var f []failure
 	matchedFiles := make(map[string]bool)
+	globs, recursive := splitGlobs(path, x.filepathGlobs, recursive)
+	if len(opts.nameKeys) != 0 {
+		var collisions []problem
+		y, collisions = opts.matchNames(x, y)
+		p = append(p, collisions...)
+	}
 
 	for _, name := range sortedKeys(x.items) {
-		if name == anyFile {
+		if name == anyFile || opts.ignored(filepath.Join(path, name), isDirectory(x.items[name])) {
 			continue
 		}
 		matchedFiles[name] = true
 		xEntry := x.items[name]
 		yEntry, ok := y.items[name]
+		if isAbsent(xEntry) {
+			if ok {
+				p = append(p, presentProblem(name, yEntry))
+			}
+			continue
+		}
+		if !ok && opts.optionalEmptyDirs && isEmptyDirectory(xEntry) {
+			continue
+		}
 		if !ok {
-			p = append(p, existenceProblem(name, "expected %s to exist", xEntry.Type()))
+			p = append(p, missingProblem(name, xEntry))
+			f = append(f, opts.subtreeFailures(filepath.Join(path, name), xEntry, missingProblem)...)
 			continue
 		}
 
+		if custom, ok := xEntry.(*customEntry); ok {
+			childPath := filepath.Join(path, name)
+			f = maybeAppendFailure(f, childPath, eqCustomEntry(childPath, custom, yEntry))
+			continue
+		}
 		if xEntry.Type() != yEntry.Type() {
-			p = append(p, notEqual(name, xEntry.Type(), yEntry.Type()))
+			p = append(p, typeProblem(name, xEntry.Type(), yEntry.Type()))
 			continue
 		}
 
-		f = append(f, eqEntry(filepath.Join(path, name), xEntry, yEntry)...)
+		f = append(f, eqEntry(opts, filepath.Join(path, name), xEntry, yEntry, recursive)...)
 	}
 
-	if len(x.filepathGlobs) != 0 {
+	if len(globs) != 0 {
 		for _, name := range sortedKeys(y.items) {
-			m := matchGlob(name, y.items[name], x.filepathGlobs)
+			m := matchGlob(opts, path, name, y.items[name], globs)
+			matchedFiles[name] = m.match
+			f = append(f, m.failures...)
+		}
+	}
+	if len(recursive) != 0 {
+		for _, name := range sortedKeys(y.items) {
+			if matchedFiles[name] {
+				continue
+			}
+			m := matchRecursiveGlobs(opts, filepath.Join(path, name), y.items[name], recursive)
 			matchedFiles[name] = m.match
 			f = append(f, m.failures...)
 		}
 	}
 
-	if _, ok := x.items[anyFile]; ok {
+	if _, ok := x.items[anyFile]; ok || opts.extraFiles {
 		return maybeAppendFailure(f, path, p)
 	}
 	for _, name := range sortedKeys(y.items) {
-		if !matchedFiles[name] {
-			p = append(p, existenceProblem(name, "unexpected %s", y.items[name].Type()))
+		yEntry := y.items[name]
+		switch {
+		case matchedFiles[name]:
+		case opts.ignored(filepath.Join(path, name), isDirectory(yEntry)):
+		case opts.optionalEmptyDirs && isEmptyDirectory(yEntry):
+		default:
+			p = append(p, unexpectedProblem(name, yEntry))
+			f = append(f, opts.subtreeFailures(filepath.Join(path, name), yEntry, unexpectedProblem)...)
+		}
+	}
+	return maybeAppendFailure(f, path, p)
+}
+
+// isEmptyDirectory returns true if entry is a directory with no entries or
+// globs.
+func isEmptyDirectory(entry dirEntry) bool {
+	dir, ok := entry.(*directory)
+	return ok && len(dir.items) == 0 && len(dir.filepathGlobs) == 0
+}
+
+// subtreeFailures reports every entry in a directory which is missing or
+// unexpected when the comparison reports all mismatches.
+func (o *compareOptions) subtreeFailures(path string, entry dirEntry, newProblem func(string, dirEntry) problem) []failure {
+	dir, ok := entry.(*directory)
+	if !ok || !o.allMismatches {
+		return nil
+	}
+	var f []failure
+	var p []problem
+	for _, name := range sortedKeys(dir.items) {
+		if name == anyFile || isAbsent(dir.items[name]) {
+			continue
 		}
+		p = append(p, newProblem(name, dir.items[name]))
+		f = append(f, o.subtreeFailures(filepath.Join(path, name), dir.items[name], newProblem)...)
 	}
 	return maybeAppendFailure(f, path, p)
 }
@@ -222,7 +539,7 @@ func sortedKeys(items map[string]dirEntry) []string {
 }
 
 // eqEntry assumes x and y to be the same type
-func eqEntry(path string, x, y dirEntry) []failure {
+func eqEntry(opts *compareOptions, path string, x, y dirEntry, recursive []recursiveGlob) []failure {
 	resp := func(problems []problem) []failure {
 		if len(problems) == 0 {
 			return nil
@@ -232,11 +549,11 @@ func eqEntry(path string, x, y dirEntry) []failure {
 
 	switch typed := x.(type) {
 	case *file:
-		return resp(eqFile(typed, y.(*file)))
+		return resp(eqFile(opts, path, typed, y.(*file)))
 	case *symlink:
-		return resp(eqSymlink(typed, y.(*symlink)))
+		return resp(eqSymlink(opts, typed, y.(*symlink)))
 	case *directory:
-		return eqDirectory(path, typed, y.(*directory))
+		return eqDirectory(opts, path, typed, y.(*directory), recursive)
 	}
 	return nil
 }
@@ -246,40 +563,156 @@ type globMatch struct {
 	failures []failure
 }
 
-func matchGlob(name string, yEntry dirEntry, globs map[string]*filePath) globMatch {
+func matchGlob(opts *compareOptions, path, name string, yEntry dirEntry, globs map[string]*filePath) globMatch {
 	m := globMatch{}
 
-	for glob, expectedFile := range globs {
+	// Globs are matched in order so that the errors from invalid patterns,
+	// which are kept when a later glob matches, are the same on every run.
+	for _, glob := range sortedGlobs(globs) {
 		ok, err := filepath.Match(glob, name)
 		if err != nil {
 			p := errProblem("failed to match glob pattern", err)
-			f := failure{path: name, problems: []problem{p}}
+			f := failure{path: filepath.Join(path, name), problems: []problem{p}}
 			m.failures = append(m.failures, f)
 		}
 		if ok {
 			m.match = true
-			m.failures = eqEntry(name, expectedFile.file, yEntry)
+			m.failures = append(m.failures, eqEntry(opts, filepath.Join(path, name), globs[glob].file, yEntry, nil)...)
 			return m
 		}
 	}
 	return m
 }
 
-func formatFailures(failures []failure) string {
+// recursiveGlob is a glob which contains a ** pattern, and matches entries
+// in the subtree of the directory at base.
+type recursiveGlob struct {
+	pattern string
+	base    string
+	file    *file
+}
+
+// splitGlobs returns the single level globs of a directory, and the recursive
+// globs which apply to the entries of the directory at path.
+func splitGlobs(path string, globs map[string]*filePath, inherited []recursiveGlob) (map[string]*filePath, []recursiveGlob) {
+	single := make(map[string]*filePath, len(globs))
+	recursive := inherited[:len(inherited):len(inherited)]
+	for _, glob := range sortedGlobs(globs) {
+		if !strings.Contains(glob, "**") {
+			single[glob] = globs[glob]
+			continue
+		}
+		recursive = append(recursive, recursiveGlob{pattern: glob, base: path, file: globs[glob].file})
+	}
+	return single, recursive
+}
+
+// matchRecursiveGlobs matches an entry which is not in the manifest against
+// the recursive globs. A directory matches when any of the entries in its
+// subtree match, and the entries which do not match are reported as
+// unexpected.
+func matchRecursiveGlobs(opts *compareOptions, path string, yEntry dirEntry, globs []recursiveGlob) globMatch {
+	m := globMatch{}
+	dir, ok := yEntry.(*directory)
+	if !ok {
+		for _, glob := range globs {
+			rel, err := filepath.Rel(glob.base, path)
+			if err != nil || !matchDoublestar(glob.pattern, filepath.ToSlash(rel)) {
+				continue
+			}
+			m.match = true
+			if glob.file.Type() == yEntry.Type() {
+				m.failures = eqEntry(opts, path, glob.file, yEntry, nil)
+			} else {
+				p := typeProblem(filepath.Base(path), glob.file.Type(), yEntry.Type())
+				m.failures = []failure{{path: filepath.Dir(path), problems: []problem{p}}}
+			}
+			return m
+		}
+		return m
+	}
+
+	var p []problem
+	for _, name := range sortedKeys(dir.items) {
+		child := matchRecursiveGlobs(opts, filepath.Join(path, name), dir.items[name], globs)
+		m.failures = append(m.failures, child.failures...)
+		if child.match {
+			m.match = true
+			continue
+		}
+		p = append(p, unexpectedProblem(name, dir.items[name]))
+	}
+	if !m.match {
+		return globMatch{}
+	}
+	m.failures = maybeAppendFailure(m.failures, path, p)
+	return m
+}
+
+// matchDoublestar reports whether the slash separated name matches pattern,
+// where a ** element of pattern matches zero or more path elements, and every
+// other element uses the syntax of [path.Match].
+func matchDoublestar(pattern, name string) bool {
+	return matchElements(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElements(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElements(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// formatFailures formats at most limit problems, or all the problems when limit
+// is 0.
+func formatFailures(failures []failure, limit int) string {
 	sort.Slice(failures, func(i, j int) bool {
 		return failures[i].path < failures[j].path
 	})
 
 	buf := new(bytes.Buffer)
+	count := 0
 	for _, failure := range failures {
+		if limit > 0 && count >= limit {
+			break
+		}
 		buf.WriteString(failure.path + "\n")
 		for _, problem := range failure.problems {
-			buf.WriteString("  " + string(problem) + "\n")
+			if limit > 0 && count >= limit {
+				break
+			}
+			buf.WriteString("  " + problem.String() + "\n")
+			count++
 		}
 	}
+	if total := countProblems(failures); total > count {
+		fmt.Fprintf(buf, "... and %d more\n", total-count)
+	}
 	return buf.String()
 }
 
+func countProblems(failures []failure) int {
+	total := 0
+	for _, failure := range failures {
+		total += len(failure.problems)
+	}
+	return total
+}
+
 func formatMessage(msgAndArgs ...interface{}) string {
 	switch len(msgAndArgs) {
 	case 0:
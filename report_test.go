@@ -1,31 +1,76 @@
 package fs
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"embed"
 	"fmt"
+	"os"
+	"os/user"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	"golang.org/x/text/unicode/norm"
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
 	"gotest.tools/v3/skip"
 )
 
 func TestEqualMissingRoot(t *testing.T) {
-	result := Equal("/bogus/path/does/not/exist", Expected(t))()
+	result := Compare("/bogus/path/does/not/exist", Expected(t))
 	assert.Assert(t, !result.Success())
 	expected := "stat /bogus/path/does/not/exist: no such file or directory"
 	if runtime.GOOS == "windows" {
 		expected = "CreateFile /bogus/path/does/not/exist"
 	}
-	assert.Assert(t, is.Contains(result.(cmpFailure).FailureMessage(), expected))
+	assert.Assert(t, is.Contains(result.FailureMessage(), expected))
+}
+
+func TestCompareContext(t *testing.T) {
+	dir := NewDir(t, t.Name(), WithFile("file1", "content"), WithDir("sub"))
+	defer dir.Remove()
+
+	result := CompareContext(context.Background(), dir.Path(), Expected(t,
+		WithFile("file1", "content"), WithDir("sub")))
+	assert.NilError(t, result.Err)
+	assert.Assert(t, result.Success())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result = CompareContext(ctx, dir.Path(), Expected(t,
+		WithFile("file1", "content"), WithDir("sub")))
+	assert.ErrorIs(t, result.Err, context.Canceled)
+}
+
+func TestEqualWithProgress(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "content"),
+		WithDir("sub", WithFile("file2", "more")))
+	defer dir.Remove()
+
+	var last Progress
+	calls := 0
+	assert.Assert(t, Equal(t, dir.Path(), Expected(t,
+		WithFile("file1", "content"),
+		WithDir("sub", WithFile("file2", "more"))),
+		WithProgress(func(p Progress) {
+			calls++
+			last = p
+		})))
+	assert.Equal(t, last, Progress{Entries: 3, Bytes: int64(len("content") + len("more"))})
+	assert.Assert(t, calls >= 5, calls)
 }
 
 func TestEqualModeMismatch(t *testing.T) {
 	dir := NewDir(t, t.Name(), WithMode(0500))
 	defer dir.Remove()
 
-	result := Equal(dir.Path(), Expected(t))()
+	result := Compare(dir.Path(), Expected(t))
 	assert.Assert(t, !result.Success())
 	expected := fmtExpected(`directory %s does not match expected:
 /
@@ -37,24 +82,24 @@ func TestEqualModeMismatch(t *testing.T) {
   mode: expected drwxrwxrwx got dr-xr-xr-x
 `, dir.Path())
 	}
-	assert.Equal(t, result.(cmpFailure).FailureMessage(), expected)
+	assert.Equal(t, result.FailureMessage(), expected)
 }
 
 func TestEqualRootIsAFile(t *testing.T) {
 	file := NewFile(t, t.Name())
 	defer file.Remove()
 
-	result := Equal(file.Path(), Expected(t))()
+	result := Compare(file.Path(), Expected(t))
 	assert.Assert(t, !result.Success())
 	expected := fmt.Sprintf("path %s must be a directory", file.Path())
-	assert.Equal(t, result.(cmpFailure).FailureMessage(), expected)
+	assert.Equal(t, result.FailureMessage(), expected)
 }
 
 func TestEqualSuccess(t *testing.T) {
 	dir := NewDir(t, t.Name(), WithMode(0700))
 	defer dir.Remove()
 
-	assert.Assert(t, Equal(dir.Path(), Expected(t)))
+	assert.Assert(t, Equal(t, dir.Path(), Expected(t)))
 }
 
 func TestEqualDirectoryHasWithExtraFiles(t *testing.T) {
@@ -63,20 +108,70 @@ func TestEqualDirectoryHasWithExtraFiles(t *testing.T) {
 	defer dir.Remove()
 
 	manifest := Expected(t, WithFile("file1", "content"))
-	result := Equal(dir.Path(), manifest)()
+	result := Compare(dir.Path(), manifest)
 	assert.Assert(t, !result.Success())
 	expected := fmtExpected(`directory %s does not match expected:
 /
   file1: expected file to exist
   extra1: unexpected file
 `, dir.Path())
-	assert.Equal(t, result.(cmpFailure).FailureMessage(), expected)
+	assert.Equal(t, result.FailureMessage(), expected)
 }
 
 func fmtExpected(format string, args ...interface{}) string {
 	return filepath.FromSlash(fmt.Sprintf(format, args...))
 }
 
+//go:embed testdata/copy-test
+var copyTestFS embed.FS
+
+func TestEqualFS(t *testing.T) {
+	dir := NewDir(t, t.Name(), FromDir("testdata/copy-test"))
+	defer dir.Remove()
+
+	assert.Assert(t, EqualFS(t, dir.Path(), copyTestFS, "testdata/copy-test"))
+}
+
+func TestEqualWithContentTransformer(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("report.txt", "generated at 2024-01-02 03:04:05\nok\n"),
+		WithFile("other.txt", "same"))
+	defer dir.Remove()
+
+	timestamp := regexp.MustCompile(`\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}`)
+	normalize := func(content []byte) []byte {
+		return timestamp.ReplaceAll(content, []byte("<TIMESTAMP>"))
+	}
+	manifest := Expected(t,
+		WithFile("report.txt", "generated at 1999-12-31 23:59:59\nok\n"),
+		WithFile("other.txt", "same"))
+	assert.Assert(t, Equal(t, dir.Path(), manifest, WithContentTransformer("*.txt", normalize)))
+}
+
+func TestEqualWithContentComparer(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithDir("sub",
+			WithFile("data", "ABC")))
+	defer dir.Remove()
+
+	manifest := Expected(t,
+		WithDir("sub",
+			WithFile("data", "abc")))
+	assert.Assert(t, Equal(t, dir.Path(), manifest, WithContentComparer("sub/*", bytes.EqualFold)))
+}
+
+func TestEqualWithContentComparerAndGlob(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithDir("sub",
+			WithFile("data.log", "ABC")))
+	defer dir.Remove()
+
+	manifest := Expected(t,
+		WithDir("sub",
+			MatchFilesWithGlob("*.log", MatchAnyFileMode, WithContent("abc"))))
+	assert.Assert(t, Equal(t, dir.Path(), manifest, WithContentComparer("sub/*.log", bytes.EqualFold)))
+}
+
 func TestEqualWithMatchAnyFileContent(t *testing.T) {
 	dir := NewDir(t, t.Name(),
 		WithFile("data", "this is some data"))
@@ -84,7 +179,7 @@ func TestEqualWithMatchAnyFileContent(t *testing.T) {
 
 	expected := Expected(t,
 		WithFile("data", "different content", MatchAnyFileContent))
-	assert.Assert(t, Equal(dir.Path(), expected))
+	assert.Assert(t, Equal(t, dir.Path(), expected))
 }
 
 func TestEqualWithFileContent(t *testing.T) {
@@ -95,7 +190,7 @@ func TestEqualWithFileContent(t *testing.T) {
 	manifest := Expected(t,
 		WithFile("file1", "line2\nline3"))
 
-	result := Equal(dir.Path(), manifest)()
+	result := Compare(dir.Path(), manifest)
 	expected := fmtExpected(`directory %s does not match expected:
 /file1
   content:
@@ -106,7 +201,107 @@ func TestEqualWithFileContent(t *testing.T) {
      line2
      line3
 `, dir.Path())
-	assert.Equal(t, result.(cmpFailure).FailureMessage(), expected)
+	assert.Equal(t, result.FailureMessage(), expected)
+}
+
+func TestEqualWithDiffContext(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "line1\nline2\nline3\nline4\nline5\n"))
+	defer dir.Remove()
+
+	manifest := Expected(t,
+		WithFile("file1", "line1\nline2\nchanged\nline4\nline5\n"))
+
+	result := Compare(dir.Path(), manifest, WithDiffContext(1))
+	expected := fmtExpected(`directory %s does not match expected:
+/file1
+  content:
+    --- expected
+    +++ actual
+    @@ -2,3 +2,3 @@
+     line2
+    -changed
+    +line3
+     line4
+`, dir.Path())
+	assert.Equal(t, result.FailureMessage(), expected)
+}
+
+func TestEqualWithBinaryContent(t *testing.T) {
+	actual := []byte{0, 1, 2, 3, 4, 5, 6, 7, 'a', 'b', 'c', 'd', 12, 13, 14, 15, 16, 17}
+	dir := NewDir(t, t.Name(),
+		WithFile("data.bin", "", WithBytes(actual)))
+	defer dir.Remove()
+
+	expected := []byte{0, 1, 2, 3, 4, 5, 6, 7, 'a', 'b', 'x', 'd', 12, 13, 14, 15}
+	manifest := Expected(t,
+		WithFile("data.bin", "", WithBytes(expected)))
+
+	result := Compare(dir.Path(), manifest)
+	expectedMsg := fmtExpected(`directory %s does not match expected:
+/data.bin
+  content:
+    binary content differs, expected 16 bytes got 18 bytes:
+    offset    expected                             actual
+    00000008  61 62 78 64 0c 0d 0e 0f  |abxd....|  61 62 63 64 0c 0d 0e 0f  |abcd....|
+    00000010                           |        |  10 11                    |..      |
+`, dir.Path())
+	assert.Equal(t, result.FailureMessage(), expectedMsg)
+}
+
+func TestEqualWithLargeContent(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), maxStreamDiffSize/8)
+	dir := NewDir(t, t.Name(),
+		WithFile("large", "", WithBytes(content)))
+	defer dir.Remove()
+
+	manifest := Expected(t,
+		WithFile("large", "", WithBytes(content)))
+	assert.Assert(t, Equal(t, dir.Path(), manifest))
+
+	changed := append([]byte{}, content...)
+	changed[maxStreamDiffSize+3] = 'x'
+	manifest = Expected(t,
+		WithFile("large", "", WithBytes(changed)))
+	result := Compare(dir.Path(), manifest)
+	expectedMsg := fmtExpected(`directory %s does not match expected:
+/large
+  content: differs at byte offset %d, too large to diff
+`, dir.Path(), maxStreamDiffSize+3)
+	assert.Equal(t, result.FailureMessage(), expectedMsg)
+}
+
+func TestEqualWithHashComparison(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "actual"),
+		WithFile("file2", "actual"),
+		WithFile("file3", "same"),
+		WithFile("file4", "actual"))
+	defer dir.Remove()
+
+	manifest := Expected(t,
+		WithFile("file1", "expected"),
+		WithFile("file2", "expected"),
+		WithFile("file3", "same"),
+		WithFile("file4", "wanted"))
+	result := Compare(dir.Path(), manifest, WithHashComparison(1))
+	expectedMsg := fmtExpected(`directory %s does not match expected:
+/file1
+  content:
+    --- expected
+    +++ actual
+    @@ -1 +1 @@
+    -expected
+    +actual
+/file2
+  content: expected 8 bytes got 6 bytes
+/file4
+  content: expected 6 bytes sha256:%x got 6 bytes sha256:%x
+`, dir.Path(), sha256.Sum256([]byte("wanted")), sha256.Sum256([]byte("actual")))
+	assert.Equal(t, result.FailureMessage(), expectedMsg)
+
+	result = Compare(dir.Path(), manifest, WithHashComparison(3))
+	assert.Assert(t, !strings.Contains(result.FailureMessage(), "sha256"), result.FailureMessage())
 }
 
 func TestEqualWithMatchContentIgnoreCarriageReturn(t *testing.T) {
@@ -117,10 +312,171 @@ func TestEqualWithMatchContentIgnoreCarriageReturn(t *testing.T) {
 	manifest := Expected(t,
 		WithFile("file1", "line1\nline2", MatchContentIgnoreCarriageReturn))
 
-	result := Equal(dir.Path(), manifest)()
+	result := Compare(dir.Path(), manifest)
 	assert.Assert(t, result.Success())
 }
 
+func TestEqualWithIgnoreCarriageReturn(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "line1\r\nline2"),
+		WithDir("sub", WithFile("file2", "line1\r\nline2\r\n")))
+	defer dir.Remove()
+
+	expected := func() Manifest {
+		return Expected(t,
+			WithFile("file1", "line1\nline2"),
+			WithDir("sub", WithFile("file2", "line1\nline2\n")))
+	}
+
+	assert.Assert(t, !Compare(dir.Path(), expected()).Success())
+	assert.Assert(t, Equal(t, dir.Path(), expected(), WithIgnoreCarriageReturn()))
+}
+
+func TestEqualWithMatchContentIgnoreTrailingNewline(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "line1\nline2\n"),
+		WithFile("file2", "line1"))
+	defer dir.Remove()
+
+	manifest := Expected(t,
+		WithFile("file1", "line1\nline2", MatchContentIgnoreTrailingNewline),
+		WithFile("file2", "line1\n", MatchContentIgnoreTrailingNewline))
+
+	result := Compare(dir.Path(), manifest)
+	assert.Assert(t, result.Success())
+}
+
+func TestEqualWithMatchContentIgnoringWhitespace(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "func main() {\n\tfmt.Println(\"a\",  1) \n}"))
+	defer dir.Remove()
+
+	t.Run("match", func(t *testing.T) {
+		manifest := Expected(t,
+			WithFile("file1", "func main() {\n    fmt.Println(\"a\", 1)\n}", MatchContentIgnoringWhitespace))
+		assert.Assert(t, Equal(t, dir.Path(), manifest))
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		manifest := Expected(t,
+			WithFile("file1", "func main() {\n    fmt.Println(\"a\", 2)\n}", MatchContentIgnoringWhitespace))
+		assert.Assert(t, !Compare(dir.Path(), manifest).Success())
+	})
+}
+
+func TestEqualWithMatchModeMask(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("run.sh", "", WithMode(0o751)),
+		WithDir("data", WithMode(0o750)))
+	defer dir.Remove()
+
+	manifest := Expected(t,
+		WithFile("run.sh", "", MatchModeMask(0o102, 0o100)),
+		WithDir("data", MatchModeMask(0o700, 0o700)))
+	assert.Assert(t, Equal(t, dir.Path(), manifest))
+
+	manifest = Expected(t,
+		WithFile("run.sh", "", MatchModeMask(0o001, 0)),
+		WithDir("data", MatchModeMask(0o700, 0o700)))
+	result := Compare(dir.Path(), manifest)
+	expected := fmtExpected(`directory %s does not match expected:
+/run.sh
+  mode (mask 0001): expected ---------- got ---------x
+`, dir.Path())
+	assert.Equal(t, result.FailureMessage(), expected)
+}
+
+func TestEqualWithIgnoreModes(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "content", WithMode(0o600)),
+		WithDir("sub", WithMode(0o700),
+			WithFile("file2", "content", WithMode(0o755))))
+	defer dir.Remove()
+
+	expected := func() Manifest {
+		return Expected(t,
+			WithFile("file1", "content", WithMode(0o644)),
+			WithDir("sub", WithMode(0o755),
+				WithFile("file2", "content", WithMode(0o644))))
+	}
+	assert.Assert(t, !Compare(dir.Path(), expected()).Success())
+	assert.Assert(t, Equal(t, dir.Path(), expected(), WithIgnoreModes()))
+}
+
+func TestEqualWithIgnoreOwnership(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "content"),
+		WithDir("sub"))
+	defer dir.Remove()
+
+	expected := func() Manifest {
+		return Expected(t,
+			WithFile("file1", "content", AsUser(4242, 4242)),
+			WithDir("sub", AsUser(4242, 4242)))
+	}
+	assert.Assert(t, !Compare(dir.Path(), expected()).Success())
+	assert.Assert(t, Equal(t, dir.Path(), expected(), WithIgnoreOwnership()))
+}
+
+func TestEqualWithMatchOwner(t *testing.T) {
+	skip.If(t, runtime.GOOS == "windows", "ownership is not supported on windows")
+	current, err := user.Current()
+	assert.NilError(t, err)
+	group, err := user.LookupGroupId(current.Gid)
+	assert.NilError(t, err)
+
+	dir := NewDir(t, t.Name(), WithFile("file1", "content"))
+	defer dir.Remove()
+
+	manifest := Expected(t, WithFile("file1", "content", MatchOwner(current.Username, group.Name)))
+	assert.Assert(t, Equal(t, dir.Path(), manifest))
+
+	manifest = Expected(t, WithFile("file1", "content", MatchOwner("no-such-user", "")))
+	result := Compare(dir.Path(), manifest)
+	expected := fmtExpected(`directory %s does not match expected:
+/file1
+  owner: expected no-such-user got %s
+`, dir.Path(), current.Username)
+	assert.Equal(t, result.FailureMessage(), expected)
+}
+
+func TestEqualWithMatchModTimeWithin(t *testing.T) {
+	dir := NewDir(t, t.Name(), WithFile("file1", "content"), WithDir("sub"))
+	defer dir.Remove()
+	now := time.Now()
+
+	manifest := Expected(t,
+		WithFile("file1", "content", MatchModTimeWithin(now, time.Minute)),
+		WithDir("sub", MatchModTimeWithin(now, time.Minute)))
+	assert.Assert(t, Equal(t, dir.Path(), manifest))
+
+	ref := now.Add(-time.Hour)
+	manifest = Expected(t,
+		WithFile("file1", "content", MatchModTimeWithin(ref, time.Minute)),
+		WithDir("sub"))
+	result := Compare(dir.Path(), manifest)
+	assert.Equal(t, len(result.Mismatches), 1)
+	assert.Equal(t, result.Mismatches[0].Kind, MismatchModTime)
+	assert.Equal(t, result.Mismatches[0].Expected, "within 1m0s of "+ref.Format(time.RFC3339Nano))
+}
+
+func TestEqualWithMatchNewerThan(t *testing.T) {
+	dir := NewDir(t, t.Name(), WithFile("cache", "content"))
+	defer dir.Remove()
+	info, err := os.Stat(dir.Join("cache"))
+	assert.NilError(t, err)
+
+	before := info.ModTime().Add(-time.Second)
+	assert.Assert(t, Equal(t, dir.Path(), Expected(t, WithFile("cache", "content", MatchNewerThan(before)))))
+
+	result := Compare(dir.Path(), Expected(t, WithFile("cache", "content", MatchNewerThan(info.ModTime()))))
+	expected := fmtExpected(`directory %s does not match expected:
+/cache
+  mtime: expected newer than %s got %s
+`, dir.Path(), info.ModTime().Format(time.RFC3339Nano), info.ModTime().Format(time.RFC3339Nano))
+	assert.Equal(t, result.FailureMessage(), expected)
+}
+
 func TestEqualDirectoryWithMatchExtraFiles(t *testing.T) {
 	file1 := WithFile("file1", "same in both")
 	dir := NewDir(t, t.Name(),
@@ -129,7 +485,253 @@ func TestEqualDirectoryWithMatchExtraFiles(t *testing.T) {
 	defer dir.Remove()
 
 	expected := Expected(t, file1, MatchExtraFiles)
-	assert.Assert(t, Equal(dir.Path(), expected))
+	assert.Assert(t, Equal(t, dir.Path(), expected))
+}
+
+func TestEqualDirectoryWithMatchAnyDirContents(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "content"),
+		WithDir("cache",
+			WithFile("entry1", "data"),
+			WithDir("nested", WithFile("entry2", "data"))))
+	defer dir.Remove()
+
+	expected := Expected(t,
+		WithFile("file1", "content"),
+		WithDir("cache", MatchAnyDirContents))
+	assert.Assert(t, Equal(t, dir.Path(), expected))
+
+	expected = Expected(t, WithDir("cache", MatchAnyDirContents))
+	result := Compare(dir.Path(), expected)
+	assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/
+  file1: unexpected file
+`, dir.Path()))
+}
+
+func TestContains(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "content"),
+		WithFile("extra", "content"),
+		WithDir("sub",
+			WithFile("file2", "content"),
+			WithDir("extra")))
+	defer dir.Remove()
+
+	expected := func() Manifest {
+		return Expected(t,
+			WithFile("file1", "content"),
+			WithDir("sub", WithFile("file2", "content")))
+	}
+	assert.Assert(t, !Compare(dir.Path(), expected()).Success())
+	assert.Assert(t, Contains(t, dir.Path(), expected()))
+
+	result := Compare(dir.Path(), Expected(t, WithFile("missing", "")), WithExtraFiles())
+	assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/
+  missing: expected file to exist
+`, dir.Path()))
+}
+
+func TestEqualWithExpectMissing(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("new.conf", "content"),
+		WithDir("etc", WithFile("old.conf", "content")))
+	defer dir.Remove()
+
+	expected := Expected(t,
+		WithFile("new.conf", "content"),
+		ExpectMissing("old.conf"),
+		WithDir("etc", MatchExtraFiles),
+		ExpectMissing("etc/old.conf"))
+	result := Compare(dir.Path(), expected)
+	assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/etc
+  old.conf: expected file to be missing
+`, dir.Path()))
+
+	err := ExpectMissing("var/old.conf")(&directoryPath{directory: newDirectoryWithDefaults()})
+	assert.ErrorContains(t, err, "directory var is not in the manifest")
+}
+
+func TestEqualWithRecursiveGlob(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("app.log", "content"),
+		WithDir("a",
+			WithFile("b.log", "content"),
+			WithDir("c", WithFile("d.log", "content"))),
+		WithDir("logs", WithFile("e.log", "content")))
+	defer dir.Remove()
+
+	logs := MatchFilesWithGlob("**/*.log", MatchAnyFileContent, MatchAnyFileMode)
+	assert.Assert(t, Equal(t, dir.Path(), Expected(t, logs, WithDir("logs"))))
+
+	dir = NewDir(t, t.Name(),
+		WithDir("a",
+			WithFile("b.log", "content"),
+			WithFile("readme", "content")),
+		WithDir("empty"))
+	defer dir.Remove()
+
+	result := Compare(dir.Path(), Expected(t, logs))
+	assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/
+  empty: unexpected directory
+/a
+  readme: unexpected file
+`, dir.Path()))
+}
+
+func TestEqualWithMaxDepth(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "content"),
+		WithDir("vendor",
+			WithDir("github.com", WithFile("lib.go", "content"))))
+	defer dir.Remove()
+
+	expected := func() Manifest {
+		return Expected(t,
+			WithFile("file1", "content"),
+			WithDir("vendor", WithDir("github.com")))
+	}
+	assert.Assert(t, !Compare(dir.Path(), expected()).Success())
+	assert.Assert(t, Equal(t, dir.Path(), expected(), WithMaxDepth(2)))
+
+	result := Compare(dir.Path(), Expected(t, WithFile("file1", "other"), WithDir("vendor")), WithMaxDepth(1))
+	assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/file1
+  content:
+    --- expected
+    +++ actual
+    @@ -1 +1 @@
+    -other
+    +content
+`, dir.Path()))
+}
+
+func TestEqualWithIgnorePatterns(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "content"),
+		WithFile("file1.tmp", "content"),
+		WithDir(".git",
+			WithFile("HEAD", "content"),
+			WithDir("objects", WithFile("ab", "content"))),
+		WithDir("sub",
+			WithFile("keep.tmp", "content"),
+			WithFile("other.tmp", "content")))
+	defer dir.Remove()
+
+	ignore := WithIgnorePatterns(".git/**", "*.tmp", "!sub/keep.tmp")
+	expected := Expected(t,
+		WithFile("file1", "content"),
+		WithDir("sub", WithFile("keep.tmp", "content")))
+	assert.Assert(t, Equal(t, dir.Path(), expected, ignore))
+
+	manifest := ManifestFromDir(t, dir.Path(), ignore)
+	assert.DeepEqual(t, sortedKeys(manifest.root.items), []string{"file1", "sub"})
+	assert.DeepEqual(t, sortedKeys(manifest.root.items["sub"].(*directory).items), []string{"keep.tmp"})
+	manifest.close()
+}
+
+func TestEqualWithIgnoreJunkFiles(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "content"),
+		WithFile(".DS_Store", ""),
+		WithFile(".file1.swp", ""),
+		WithDir("sub",
+			WithFile("Thumbs.db", ""),
+			WithFile("file2~", "")))
+	defer dir.Remove()
+
+	expected := func() Manifest {
+		return Expected(t, WithFile("file1", "content"), WithDir("sub"))
+	}
+	assert.Assert(t, !Compare(dir.Path(), expected()).Success())
+	assert.Assert(t, Equal(t, dir.Path(), expected(), WithIgnoreJunkFiles()))
+}
+
+func TestEqualWithCaseInsensitiveNames(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("README.md", "content"),
+		WithDir("Docs", WithFile("Index.html", "content")))
+	defer dir.Remove()
+
+	expected := func() Manifest {
+		return Expected(t,
+			WithFile("readme.md", "content"),
+			WithDir("docs", WithFile("index.html", "content")))
+	}
+	assert.Assert(t, !Compare(dir.Path(), expected()).Success())
+	assert.Assert(t, Equal(t, dir.Path(), expected(), WithCaseInsensitiveNames()))
+
+	actual := Expected(t,
+		WithFile("readme.md", "content"),
+		WithFile("README.md", "content"))
+	result := CompareManifest(actual, Expected(t, WithFile("readme.md", "content")), WithCaseInsensitiveNames())
+	assert.Equal(t, result.FailureMessage(), fmtExpected(`manifest does not match expected:
+/
+  readme.md: name collides with README.md
+`))
+}
+
+func TestEqualWithUnicodeNormalization(t *testing.T) {
+	nfd := "cafe\u0301"
+	nfc := "caf\u00e9"
+	dir := NewDir(t, t.Name(), WithFile(nfd, "content"))
+	defer dir.Remove()
+
+	expected := func() Manifest {
+		return Expected(t, WithFile(nfc, "content"))
+	}
+	normalize := WithUnicodeNormalization(norm.NFC)
+	assert.Assert(t, Equal(t, dir.Path(), expected(), normalize))
+
+	manifest := ManifestFromDir(t, dir.Path(), normalize)
+	assert.DeepEqual(t, sortedKeys(manifest.root.items), []string{nfc})
+	manifest.close()
+}
+
+func TestEqualWithAggregates(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "0123456789"),
+		WithDir("sub",
+			WithFile("file2", "0123456789"),
+			WithDir("nested", WithFile("file3", "0123456789"))))
+	defer dir.Remove()
+
+	manifest := Expected(t,
+		MatchTotalSizeUnder(31),
+		MatchEntryCount(5),
+		MatchAnyDirContents)
+	assert.Assert(t, Equal(t, dir.Path(), manifest))
+
+	manifest = Expected(t,
+		MatchTotalSizeUnder(30),
+		MatchEntryCount(4),
+		MatchAnyDirContents)
+	result := Compare(dir.Path(), manifest)
+	assert.Equal(t, result.FailureMessage(), fmtExpected(`directory %s does not match expected:
+/
+  total size: expected under 30 got 30
+  entry count: expected 4 got 5
+`, dir.Path()))
+}
+
+func TestEqualWithOptionalEmptyDirs(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "content"),
+		WithDir("created"),
+		WithDir("sub", WithDir("created")))
+	defer dir.Remove()
+
+	expected := func() Manifest {
+		return Expected(t,
+			WithFile("file1", "content"),
+			WithDir("expected"),
+			WithDir("sub"))
+	}
+	assert.Assert(t, !Compare(dir.Path(), expected()).Success())
+	assert.Assert(t, Equal(t, dir.Path(), expected(), WithOptionalEmptyDirs()))
 }
 
 func TestEqualManyFailures(t *testing.T) {
@@ -144,7 +746,7 @@ func TestEqualManyFailures(t *testing.T) {
 			WithFile("somefile", "")),
 		WithFile("file1", "not the\nsame in both"))
 
-	result := Equal(dir.Path(), manifest)()
+	result := Compare(dir.Path(), manifest)
 	assert.Assert(t, !result.Success())
 
 	expected := fmtExpected(`directory %s does not match expected:
@@ -160,11 +762,177 @@ func TestEqualManyFailures(t *testing.T) {
     -not the
      same in both
 `, dir.Path())
-	assert.Equal(t, result.(cmpFailure).FailureMessage(), expected)
+	assert.Equal(t, result.FailureMessage(), expected)
 }
 
-type cmpFailure interface {
-	FailureMessage() string
+func TestCompareMismatches(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "same in both"),
+		WithFile("extra", "some content"),
+		WithDir("sub",
+			WithFile("file2", "actual")))
+	defer dir.Remove()
+
+	manifest := Expected(t,
+		WithFile("file1", "same in both"),
+		WithFile("missing", ""),
+		WithDir("sub",
+			WithFile("file2", "expected")))
+
+	result := Compare(dir.Path(), manifest)
+	assert.Assert(t, !result.Success())
+
+	var mismatches []Mismatch
+	for _, m := range result.Mismatches {
+		m.Message = ""
+		mismatches = append(mismatches, m)
+	}
+	expected := []Mismatch{
+		{Path: filepath.FromSlash("/extra"), Kind: MismatchUnexpected, Actual: "file"},
+		{Path: filepath.FromSlash("/missing"), Kind: MismatchMissing, Expected: "file"},
+		{Path: filepath.FromSlash("/sub/file2"), Kind: MismatchContent, Expected: "expected", Actual: "actual"},
+	}
+	assert.DeepEqual(t, mismatches, expected)
+}
+
+func TestCompareWithAllMismatches(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithDir("extra",
+			WithFile("a", ""),
+			WithDir("b",
+				WithFile("c", ""))))
+	defer dir.Remove()
+
+	manifest := Expected(t,
+		WithDir("missing",
+			WithFile("d", "")))
+
+	result := Compare(dir.Path(), manifest, WithAllMismatches())
+	expected := fmtExpected(`directory %s does not match expected:
+/
+  missing: expected directory to exist
+  extra: unexpected directory
+/extra
+  a: unexpected file
+  b: unexpected directory
+/extra/b
+  c: unexpected file
+/missing
+  d: expected file to exist
+`, dir.Path())
+	assert.Equal(t, result.FailureMessage(), expected)
+}
+
+func TestCompareWithOutputLimits(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("a", "1\n2\n3\n4\n5\n"),
+		WithFile("b", ""),
+		WithFile("c", ""),
+		WithFile("d", ""))
+	defer dir.Remove()
+
+	manifest := Expected(t, WithFile("a", ""))
+	result := Compare(dir.Path(), manifest, WithMaxMismatches(2), WithMaxDiffLines(4))
+	expected := fmtExpected(`directory %s does not match expected:
+/
+  b: unexpected file
+  c: unexpected file
+... and 2 more
+`, dir.Path())
+	assert.Equal(t, result.FailureMessage(), expected)
+	assert.Equal(t, len(result.Mismatches), 4)
+
+	manifest = Expected(t, WithFile("a", "1\n"), MatchExtraFiles)
+	result = Compare(dir.Path(), manifest, WithMaxDiffLines(4))
+	expected = fmtExpected(`directory %s does not match expected:
+/a
+  content:
+    --- expected
+    +++ actual
+    @@ -1,2 +1,6 @@
+     1
+    ... and 5 more lines
+`, dir.Path())
+	assert.Equal(t, result.FailureMessage(), expected)
+}
+
+func TestCompareWithTreeOutput(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", "same"),
+		WithFile("extra", ""),
+		WithDir("sub",
+			WithFile("file2", "actual")))
+	defer dir.Remove()
+
+	manifest := Expected(t,
+		WithFile("file1", "same"),
+		WithDir("sub",
+			WithFile("file2", "expected"),
+			WithFile("missing", "")))
+
+	result := Compare(dir.Path(), manifest, WithTreeOutput())
+	expected := fmtExpected(`directory %s does not match expected:
+✓ /
+  ✗ extra
+      unexpected file
+  ✓ file1
+  ✓ sub/
+    ✗ file2
+        content:
+            --- expected
+            +++ actual
+            @@ -1 +1 @@
+            -expected
+            +actual
+    ✗ missing
+        expected file to exist
+`, dir.Path())
+	assert.Equal(t, result.FailureMessage(), expected)
+}
+
+func TestCompareWithJSONOutput(t *testing.T) {
+	dir := NewDir(t, t.Name(), WithFile("extra", ""))
+	defer dir.Remove()
+
+	result := Compare(dir.Path(), Expected(t, WithDir("missing")), WithJSONOutput())
+	expected := fmtExpected(`directory %s does not match expected:
+`, dir.Path()) + fmt.Sprintf(`{
+  "success": false,
+  "mismatches": [
+    {
+      "path": %q,
+      "category": "unexpected",
+      "actual": "file",
+      "message": "extra: unexpected file"
+    },
+    {
+      "path": %q,
+      "category": "missing",
+      "expected": "directory",
+      "message": "missing: expected directory to exist"
+    }
+  ]
+}
+`, filepath.FromSlash("/extra"), filepath.FromSlash("/missing"))
+	assert.Equal(t, result.FailureMessage(), expected)
+}
+
+func TestCompareWithRootPlaceholder(t *testing.T) {
+	dir := NewDir(t, t.Name(),
+		WithFile("file1", ""),
+		WithSymlink("link", "file1"))
+	defer dir.Remove()
+
+	manifest := Expected(t,
+		WithFile("file1", ""),
+		WithSymlink("link", "file2"))
+	result := Compare(dir.Path(), manifest, WithRootPlaceholder("<ROOT>"))
+	expected := fmtExpected(`directory <ROOT> does not match expected:
+/link
+  target: expected file2 got <ROOT>/file1
+`)
+	assert.Equal(t, result.FailureMessage(), expected)
+	assert.Equal(t, result.Mismatches[0].Actual, fmtExpected("<ROOT>/file1"))
 }
 
 func TestMatchAnyFileMode(t *testing.T) {
@@ -175,7 +943,7 @@ func TestMatchAnyFileMode(t *testing.T) {
 
 	expected := Expected(t,
 		WithFile("data", "content", MatchAnyFileMode))
-	assert.Assert(t, Equal(dir.Path(), expected))
+	assert.Assert(t, Equal(t, dir.Path(), expected))
 }
 
 func TestMatchFileContent(t *testing.T) {
@@ -189,7 +957,7 @@ func TestMatchFileContent(t *testing.T) {
 		}
 		manifest := Expected(t,
 			WithFile("data", "different", MatchFileContent(matcher)))
-		assert.Assert(t, Equal(dir.Path(), manifest))
+		assert.Assert(t, Equal(t, dir.Path(), manifest))
 	})
 
 	t.Run("content does not match", func(t *testing.T) {
@@ -198,14 +966,14 @@ func TestMatchFileContent(t *testing.T) {
 		}
 		manifest := Expected(t,
 			WithFile("data", "content", MatchFileContent(matcher)))
-		result := Equal(dir.Path(), manifest)()
+		result := Compare(dir.Path(), manifest)
 		assert.Assert(t, !result.Success())
 
 		expected := fmtExpected(`directory %s does not match expected:
 /data
   content: data content differs from expected
 `, dir.Path())
-		assert.Equal(t, result.(cmpFailure).FailureMessage(), expected)
+		assert.Equal(t, result.FailureMessage(), expected)
 	})
 }
 
@@ -220,7 +988,7 @@ func TestMatchExtraFilesGlob(t *testing.T) {
 		manifest := Expected(t,
 			MatchFilesWithGlob("*.go", MatchAnyFileMode, MatchAnyFileContent),
 			MatchFilesWithGlob("*.yml", MatchAnyFileMode, MatchAnyFileContent))
-		assert.Assert(t, Equal(dir.Path(), manifest))
+		assert.Assert(t, Equal(t, dir.Path(), manifest))
 	})
 
 	t.Run("matching globs with wrong mode", func(t *testing.T) {
@@ -229,31 +997,31 @@ func TestMatchExtraFilesGlob(t *testing.T) {
 			MatchFilesWithGlob("*.go", MatchAnyFileMode, MatchAnyFileContent),
 			MatchFilesWithGlob("*.yml", MatchAnyFileContent, WithMode(0700)))
 
-		result := Equal(dir.Path(), manifest)()
+		result := Compare(dir.Path(), manifest)
 
 		assert.Assert(t, !result.Success())
 		expected := fmtExpected(`directory %s does not match expected:
-conf.yml
+/conf.yml
   mode: expected -rwx------ got -rw-------
 `, dir.Path())
-		assert.Equal(t, result.(cmpFailure).FailureMessage(), expected)
+		assert.Equal(t, result.FailureMessage(), expected)
 	})
 
 	t.Run("matching partial glob", func(t *testing.T) {
 		manifest := Expected(t, MatchFilesWithGlob("*.go", MatchAnyFileMode, MatchAnyFileContent))
-		result := Equal(dir.Path(), manifest)()
+		result := Compare(dir.Path(), manifest)
 		assert.Assert(t, !result.Success())
 
 		expected := fmtExpected(`directory %s does not match expected:
 /
   conf.yml: unexpected file
 `, dir.Path())
-		assert.Equal(t, result.(cmpFailure).FailureMessage(), expected)
+		assert.Equal(t, result.FailureMessage(), expected)
 	})
 
 	t.Run("invalid glob", func(t *testing.T) {
 		manifest := Expected(t, MatchFilesWithGlob("[-x]"))
-		result := Equal(dir.Path(), manifest)()
+		result := Compare(dir.Path(), manifest)
 		assert.Assert(t, !result.Success())
 
 		expected := fmtExpected(`directory %s does not match expected:
@@ -261,13 +1029,33 @@ conf.yml
   a.go: unexpected file
   conf.yml: unexpected file
   t.go: unexpected file
-a.go
+/a.go
+  failed to match glob pattern: syntax error in pattern
+/conf.yml
+  failed to match glob pattern: syntax error in pattern
+/t.go
+  failed to match glob pattern: syntax error in pattern
+`, dir.Path())
+		assert.Equal(t, result.FailureMessage(), expected)
+	})
+
+	t.Run("invalid glob before a matching glob", func(t *testing.T) {
+		manifest := Expected(t,
+			MatchFilesWithGlob("[-x]"),
+			MatchFilesWithGlob("t*", MatchAnyFileMode, MatchAnyFileContent))
+		result := Compare(dir.Path(), manifest)
+
+		expected := fmtExpected(`directory %s does not match expected:
+/
+  a.go: unexpected file
+  conf.yml: unexpected file
+/a.go
   failed to match glob pattern: syntax error in pattern
-conf.yml
+/conf.yml
   failed to match glob pattern: syntax error in pattern
-t.go
+/t.go
   failed to match glob pattern: syntax error in pattern
 `, dir.Path())
-		assert.Equal(t, result.(cmpFailure).FailureMessage(), expected)
+		assert.Equal(t, result.FailureMessage(), expected)
 	})
 }
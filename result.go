@@ -0,0 +1,209 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MismatchKind identifies the property of an entry which did not match the
+// expected value.
+type MismatchKind string
+
+const (
+	// MismatchMissing is an entry which was expected to exist but does not.
+	MismatchMissing MismatchKind = "missing"
+	// MismatchUnexpected is an entry which exists but was not expected.
+	MismatchUnexpected MismatchKind = "unexpected"
+	// MismatchType is an entry which is a different type of resource, for
+	// example a file instead of a directory.
+	MismatchType MismatchKind = "type"
+	// MismatchMode is an entry with a different file mode.
+	MismatchMode MismatchKind = "mode"
+	// MismatchUID is an entry with a different owner.
+	MismatchUID MismatchKind = "uid"
+	// MismatchGID is an entry with a different group.
+	MismatchGID MismatchKind = "gid"
+	// MismatchContent is a file with different content.
+	MismatchContent MismatchKind = "content"
+	// MismatchModTime is an entry with an unexpected modification time.
+	MismatchModTime MismatchKind = "mtime"
+	// MismatchLink is a file which is not the same file as another entry.
+	MismatchLink MismatchKind = "link"
+	// MismatchLayout is a sparse file with data in different extents.
+	MismatchLayout MismatchKind = "layout"
+	// MismatchSize is a directory with a larger total size than expected.
+	MismatchSize MismatchKind = "size"
+	// MismatchCount is a directory with a different number of entries.
+	MismatchCount MismatchKind = "count"
+	// MismatchCustom is an entry which does not match an [EntryMatcher].
+	MismatchCustom MismatchKind = "custom"
+	// MismatchTarget is a symlink with a different target.
+	MismatchTarget MismatchKind = "target"
+	// MismatchError is an entry which could not be compared because of an
+	// error.
+	MismatchError MismatchKind = "error"
+)
+
+// Mismatch is a single difference between a filesystem and a [Manifest].
+type Mismatch struct {
+	// Path is the path of the entry relative to the root of the comparison.
+	Path string       `json:"path"`
+	Kind MismatchKind `json:"category"`
+	// Expected and Actual are the values which did not match. They are empty
+	// when the value does not apply to Kind, for example the Actual value of a
+	// missing entry.
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	// Message describes the mismatch in the format used by [Result.FailureMessage].
+	Message string `json:"message"`
+}
+
+// Result is the result of comparing a filesystem to a [Manifest]. Result
+// implements [CompareResult].
+type Result struct {
+	// Mismatches contains every difference found by the comparison, sorted by
+	// path.
+	Mismatches []Mismatch
+	// Err is the error which prevented the comparison, if any.
+	Err error
+
+	header   string
+	failures []failure
+	opts     *compareOptions
+	expected *directory
+	actual   *directory
+	// redact replaces the root of the comparison in the failure message.
+	redact *strings.Replacer
+}
+
+// Compare compares a directory to the expected structure described by a
+// manifest and returns the [Result]. Unlike [Equal], Compare does not fail the
+// test, which allows the differences to be inspected.
+func Compare(path string, expected Manifest, opts ...CompareOption) Result {
+	return CompareContext(context.Background(), path, expected, opts...)
+}
+
+// CompareContext compares a directory to the expected structure described by a
+// manifest, like [Compare], and stops reading the directory once ctx is done.
+// If ctx is done before the comparison finishes the Err of the [Result] is the
+// error from ctx.
+func CompareContext(ctx context.Context, path string, expected Manifest, opts ...CompareOption) Result {
+	o := newCompareOptions(opts)
+	o.ctx = ctx
+	actual, err := manifestFromDir(path, o)
+	if err != nil {
+		return Result{Err: err, redact: o.redactRoot(path)}
+	}
+	header := fmt.Sprintf("directory %s does not match expected:\n", path)
+	result := compareManifest(header, actual, expected, o)
+	if err := ctx.Err(); err != nil {
+		return Result{Err: err, redact: o.redactRoot(path)}
+	}
+	if result.redact = o.redactRoot(path); result.redact != nil {
+		for i, m := range result.Mismatches {
+			m.Expected = result.redact.Replace(m.Expected)
+			m.Actual = result.redact.Replace(m.Actual)
+			m.Message = result.redact.Replace(m.Message)
+			result.Mismatches[i] = m
+		}
+	}
+	return result
+}
+
+// CompareManifest compares a [Manifest] to the expected structure described by
+// another manifest and returns the [Result].
+func CompareManifest(actual, expected Manifest, opts ...CompareOption) Result {
+	return compareManifest("manifest does not match expected:\n", actual, expected, newCompareOptions(opts))
+}
+
+func compareManifest(header string, actual, expected Manifest, opts *compareOptions) Result {
+	opts.actualRoot = actual.root
+	failures := eqDirectory(opts, string(os.PathSeparator), expected.root, actual.root, nil)
+	result := newResult(header, failures)
+	result.opts = opts
+	result.expected = expected.root
+	result.actual = actual.root
+	return result
+}
+
+func newResult(header string, failures []failure) Result {
+	result := Result{header: header, failures: failures}
+	for _, f := range failures {
+		for _, p := range f.problems {
+			path := f.path
+			if p.name != "" {
+				path = filepath.Join(path, p.name)
+			}
+			result.Mismatches = append(result.Mismatches, Mismatch{
+				Path:     path,
+				Kind:     p.kind,
+				Expected: p.expected,
+				Actual:   p.actual,
+				Message:  p.String(),
+			})
+		}
+	}
+	sort.SliceStable(result.Mismatches, func(i, j int) bool {
+		return result.Mismatches[i].Path < result.Mismatches[j].Path
+	})
+	return result
+}
+
+// Success returns true if the filesystem matched the manifest.
+func (r Result) Success() bool {
+	return r.Err == nil && len(r.failures) == 0
+}
+
+// FailureMessage returns a description of all the differences between the
+// filesystem and the manifest.
+func (r Result) FailureMessage() string {
+	if r.redact != nil {
+		return r.redact.Replace(r.failureMessage())
+	}
+	return r.failureMessage()
+}
+
+func (r Result) failureMessage() string {
+	switch {
+	case r.Err != nil:
+		return r.Err.Error()
+	case r.Success():
+		return ""
+	}
+	switch {
+	case r.opts.jsonOutput:
+		out, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return fmt.Sprintf("failed to format result as JSON: %s", err)
+		}
+		return r.header + string(out) + "\n"
+	case r.opts.treeOutput:
+		return r.header + r.Tree()
+	}
+	return r.header + formatFailures(r.failures, r.opts.maxMismatches)
+}
+
+type jsonResult struct {
+	Success    bool       `json:"success"`
+	Error      string     `json:"error,omitempty"`
+	Mismatches []Mismatch `json:"mismatches"`
+}
+
+// MarshalJSON returns the result as a JSON object with the fields success,
+// error, and mismatches. Each mismatch has the fields path, category, expected,
+// actual, and message.
+func (r Result) MarshalJSON() ([]byte, error) {
+	out := jsonResult{Success: r.Success(), Mismatches: r.Mismatches}
+	if r.Err != nil {
+		out.Error = r.Err.Error()
+	}
+	if out.Mismatches == nil {
+		out.Mismatches = []Mismatch{}
+	}
+	return json.Marshal(out)
+}
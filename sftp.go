@@ -0,0 +1,57 @@
+package fs
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/sftp"
+)
+
+// NewSFTPRemote returns a [RemoteFS] which reads files from a remote host using
+// client.
+func NewSFTPRemote(client *sftp.Client) RemoteFS {
+	return &sftpRemote{client: client}
+}
+
+type sftpRemote struct {
+	client *sftp.Client
+}
+
+func (r *sftpRemote) Stat(path string) (os.FileInfo, error) {
+	info, err := r.client.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return sftpFileInfo{info}, nil
+}
+
+func (r *sftpRemote) ReadDir(path string) ([]os.FileInfo, error) {
+	infos, err := r.client.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, info := range infos {
+		infos[i] = sftpFileInfo{info}
+	}
+	return infos, nil
+}
+
+func (r *sftpRemote) ReadLink(path string) (string, error) {
+	return r.client.ReadLink(path)
+}
+
+func (r *sftpRemote) Open(path string) (io.ReadCloser, error) {
+	return r.client.Open(path)
+}
+
+// sftpFileInfo reports the ownership of a remote file.
+type sftpFileInfo struct {
+	os.FileInfo
+}
+
+func (i sftpFileInfo) Owner() (uid, gid uint32) {
+	if stat, ok := i.Sys().(*sftp.FileStat); ok {
+		return stat.UID, stat.GID
+	}
+	return currentUID(), currentGID()
+}
@@ -0,0 +1,74 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+)
+
+// Extent is a range of a sparse file which contains data. The ranges of a file
+// which are not in an extent are holes.
+type Extent struct {
+	Offset int64
+	Length int64
+}
+
+func (e Extent) String() string {
+	return fmt.Sprintf("%d+%d", e.Offset, e.Length)
+}
+
+// WithSparseLayout is a [CompareOption] which compares the layout of data and
+// holes in sparse files, in addition to their content. [ManifestFromDir] also
+// records the layout of each file when it is used with this option, so that a
+// sparse copy can be compared to the original. The layout is only compared for
+// files with an expected layout, see [MatchDataExtents].
+//
+// The layout is read using SEEK_DATA and SEEK_HOLE, which are only supported
+// on Linux. On other platforms reading a directory with this option fails.
+// The size of extents depends on the block size of the filesystem.
+func WithSparseLayout() CompareOption {
+	return func(o *compareOptions) {
+		o.sparseLayout = true
+	}
+}
+
+// MatchDataExtents is a [PathOp] that updates a [Manifest] so that the file at
+// path must contain data only in extents, when it is compared using
+// [WithSparseLayout]. A file with no extents must be entirely a hole.
+func MatchDataExtents(extents ...Extent) PathOp {
+	return func(path Path) error {
+		if m, ok := path.(*filePath); ok {
+			m.file.extents = append([]Extent{}, extents...)
+		}
+		return nil
+	}
+}
+
+// readExtents records the extents of a file read from a directory, and
+// returns the content to the start of the file.
+func readExtents(f *file) error {
+	content, ok := f.content.(*lazyFile)
+	if !ok {
+		return nil
+	}
+	file, err := os.Open(content.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	extents, err := dataExtents(file)
+	if err != nil {
+		return fmt.Errorf("failed to read layout of %s: %w", content.path, err)
+	}
+	f.extents = extents
+	return nil
+}
+
+func eqExtents(x, y []Extent) []problem {
+	if x == nil {
+		return nil
+	}
+	if fmt.Sprint(x) != fmt.Sprint(y) {
+		return []problem{notEqual(MismatchLayout, "data extents", x, y)}
+	}
+	return nil
+}
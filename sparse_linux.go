@@ -0,0 +1,36 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+func dataExtents(f *os.File) ([]Extent, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	extents := []Extent{}
+	for offset := int64(0); offset < info.Size(); {
+		data, err := f.Seek(offset, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		hole, err := f.Seek(data, seekHole)
+		if err != nil {
+			return nil, err
+		}
+		extents = append(extents, Extent{Offset: data, Length: hole - data})
+		offset = hole
+	}
+	return extents, nil
+}
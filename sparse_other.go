@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package fs
+
+import (
+	"errors"
+	"os"
+)
+
+func dataExtents(f *os.File) ([]Extent, error) {
+	return nil, errors.New("sparse layout is not supported on this platform")
+}
@@ -0,0 +1,50 @@
+package fs
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/skip"
+)
+
+func TestEqualWithSparseLayout(t *testing.T) {
+	skip.If(t, runtime.GOOS != "linux", "sparse layout is only supported on linux")
+
+	const size = 4 << 20
+	withSparseFile := func(path Path) error {
+		f, err := os.Create(path.Path())
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := f.Truncate(size); err != nil {
+			return err
+		}
+		_, err = f.WriteAt([]byte("data"), 2<<20)
+		return err
+	}
+	content := make([]byte, size)
+	copy(content[2<<20:], "data")
+
+	sparse := NewDir(t, t.Name(), WithFile("disk.img", "", withSparseFile))
+	defer sparse.Remove()
+	dense := NewDir(t, t.Name(), WithFile("disk.img", "", WithBytes(content)))
+	defer dense.Remove()
+
+	layout := ManifestFromDir(t, sparse.Path(), WithSparseLayout())
+	extents := layout.root.items["disk.img"].(*file).extents
+	layout.close()
+	skip.If(t, len(extents) == 1 && extents[0].Length == size, "filesystem does not support holes")
+
+	assert.Assert(t, Equal(t, sparse.Path(), ManifestFromDir(t, sparse.Path(), WithSparseLayout()), WithSparseLayout()))
+	assert.Assert(t, Equal(t, dense.Path(), ManifestFromDir(t, sparse.Path())))
+
+	result := Compare(dense.Path(), ManifestFromDir(t, sparse.Path(), WithSparseLayout()), WithSparseLayout())
+	assert.Equal(t, len(result.Mismatches), 1)
+	assert.Equal(t, result.Mismatches[0].Kind, MismatchLayout)
+
+	manifest := Expected(t, WithFile("disk.img", "", WithBytes(content), MatchDataExtents(extents...)))
+	assert.Assert(t, Equal(t, sparse.Path(), manifest, WithSparseLayout()))
+}
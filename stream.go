@@ -0,0 +1,189 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+)
+
+const (
+	// streamChunkSize is the size of the chunks in which content is compared.
+	streamChunkSize = 64 << 10
+	// maxStreamDiffSize is the size of the largest content which is diffed
+	// when streamed content does not match. Larger content is reported by the
+	// offset of the first difference.
+	maxStreamDiffSize = 1 << 20
+)
+
+// streamable returns true if the content of x and y can be compared in chunks,
+// because no option or PathOp needs to see the whole content of the file.
+func (o *compareOptions) streamable(path string, x, y *file) bool {
+	if o.ignoreCarriageReturn || o.comparer(path) != nil {
+		return false
+	}
+	for _, t := range o.transformers {
+		if matchPattern(t.pattern, path) {
+			return false
+		}
+	}
+	return x.compareContentFunc == nil && x.contentFunc == nil &&
+		!x.ignoreCariageReturn && !y.ignoreCariageReturn &&
+		!x.ignoreTrailingNewline && !y.ignoreTrailingNewline &&
+		!x.ignoreWhitespace && !y.ignoreWhitespace
+}
+
+// eqContent compares the content of x and y. When hash comparison is enabled,
+// content is compared by size and digest, and is only diffed for the first
+// mismatches.
+func (o *compareOptions) eqContent(x, y *file) []problem {
+	if !o.hashComparison {
+		return eqContentStream(o, x.content, y.content)
+	}
+	p := o.eqContentHash(x, y)
+	if len(p) > 0 {
+		o.contentMismatches++
+	}
+	return p
+}
+
+// eqContentHash compares the size of x and y, and the SHA-256 digest of their
+// content when the sizes are the same. The content is only read if the size of
+// a file is not known, or the sizes are the same. Until hashFullDiffs
+// mismatches were found, a mismatch is reported with a diff.
+func (o *compareOptions) eqContentHash(x, y *file) []problem {
+	fullDiff := o.contentMismatches < o.hashFullDiffs
+	xSize, ySize := contentSize(x), contentSize(y)
+	if xSize >= 0 && ySize >= 0 && xSize != ySize {
+		if fullDiff {
+			return eqContentStream(o, x.content, y.content)
+		}
+		return []problem{notEqual(MismatchContent, "content",
+			fmt.Sprintf("%d bytes", xSize), fmt.Sprintf("%d bytes", ySize))}
+	}
+
+	var xBuf, yBuf *cappedBuffer
+	if fullDiff {
+		xBuf = &cappedBuffer{max: maxStreamDiffSize}
+		yBuf = &cappedBuffer{max: maxStreamDiffSize}
+	}
+	xSize, xSum, err := hashContent(x.content, xBuf)
+	if err != nil {
+		return []problem{errProblem("failed to read expected content", err)}
+	}
+	ySize, ySum, err := hashContent(y.content, yBuf)
+	if err != nil {
+		return []problem{errProblem("failed to read actual content", err)}
+	}
+	switch {
+	case xSize == ySize && xSum == ySum:
+		return nil
+	case fullDiff && !xBuf.overflow && !yBuf.overflow:
+		return []problem{diffContent(o, xBuf.Bytes(), yBuf.Bytes())}
+	}
+	return []problem{notEqual(MismatchContent, "content",
+		fmt.Sprintf("%d bytes sha256:%s", xSize, xSum),
+		fmt.Sprintf("%d bytes sha256:%s", ySize, ySum))}
+}
+
+// hashContent returns the size and digest of the content read from r. The
+// content is also written to buf, unless it is nil, so that it can be diffed.
+func hashContent(r io.Reader, buf *cappedBuffer) (int64, string, error) {
+	h := sha256.New()
+	var w io.Writer = h
+	if buf != nil {
+		w = io.MultiWriter(h, buf)
+	}
+	n, err := io.Copy(w, r)
+	return n, fmt.Sprintf("%x", h.Sum(nil)), err
+}
+
+// eqContentStream compares the content read from x and y in fixed size chunks,
+// so that large files are never read fully into memory. Content is buffered up
+// to maxStreamDiffSize so that a diff can be shown if the content differs.
+func eqContentStream(opts *compareOptions, x, y io.Reader) []problem {
+	xBuf := &cappedBuffer{max: maxStreamDiffSize}
+	yBuf := &cappedBuffer{max: maxStreamDiffSize}
+	xChunk := make([]byte, streamChunkSize)
+	yChunk := make([]byte, streamChunkSize)
+
+	var offset int64
+	for {
+		xn, xErr := io.ReadFull(x, xChunk)
+		yn, yErr := io.ReadFull(y, yChunk)
+		if xErr = eofIsNil(xErr); xErr != nil {
+			return []problem{errProblem("failed to read expected content", xErr)}
+		}
+		if yErr = eofIsNil(yErr); yErr != nil {
+			return []problem{errProblem("failed to read actual content", yErr)}
+		}
+		xBuf.Write(xChunk[:xn])
+		yBuf.Write(yChunk[:yn])
+
+		if xn != yn || !bytes.Equal(xChunk[:xn], yChunk[:yn]) {
+			offset += int64(firstDifference(xChunk[:xn], yChunk[:yn]))
+			xBuf.readFrom(x)
+			yBuf.readFrom(y)
+			if xBuf.overflow || yBuf.overflow {
+				return []problem{{
+					kind:    MismatchContent,
+					message: fmt.Sprintf("content: differs at byte offset %d, too large to diff", offset),
+				}}
+			}
+			return []problem{diffContent(opts, xBuf.Bytes(), yBuf.Bytes())}
+		}
+		if xn < streamChunkSize {
+			return nil
+		}
+		offset += int64(xn)
+	}
+}
+
+func eofIsNil(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil
+	}
+	return err
+}
+
+// firstDifference returns the index of the first byte which differs between x
+// and y.
+func firstDifference(x, y []byte) int {
+	n := min(len(x), len(y))
+	for i := 0; i < n; i++ {
+		if x[i] != y[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// cappedBuffer is a buffer which discards its content once more than max bytes
+// have been written to it.
+type cappedBuffer struct {
+	bytes.Buffer
+	max      int
+	overflow bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.overflow || b.Len()+len(p) > b.max {
+		b.overflow = true
+		b.Reset()
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// readFrom reads the rest of r into the buffer, stopping early if the buffer
+// overflows. Errors are ignored because the content is only used for a diff.
+func (b *cappedBuffer) readFrom(r io.Reader) {
+	chunk := make([]byte, streamChunkSize)
+	for !b.overflow {
+		n, err := r.Read(chunk)
+		b.Write(chunk[:n])
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package fs
+
+// OnTmpfs is a [PathOp] which moves a new [Dir] or [File] to a tmpfs, so that
+// I/O heavy tests are not slowed down by the disk. If no tmpfs is available the
+// Dir or File is left in the default temporary directory. OnTmpfs must be the
+// first PathOp passed to [NewDir] or [NewFile]. When used with a [Manifest]
+// OnTmpfs has no effect.
+func OnTmpfs() PathOp {
+	return func(path Path) error {
+		root := tmpfsRoot()
+		if root == "" {
+			return nil
+		}
+		return relocate(path, root)
+	}
+}
@@ -0,0 +1,27 @@
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	tmpfsMagic = 0x01021994
+	// writeOK is W_OK for access(2).
+	writeOK = 2
+)
+
+// tmpfsRoot returns a writable directory on a tmpfs, or an empty string if
+// there is none.
+func tmpfsRoot() string {
+	for _, dir := range []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"} {
+		var stat syscall.Statfs_t
+		if dir == "" || syscall.Statfs(dir, &stat) != nil || stat.Type != tmpfsMagic {
+			continue
+		}
+		if syscall.Access(dir, writeOK) == nil {
+			return dir
+		}
+	}
+	return ""
+}
@@ -0,0 +1,24 @@
+package fs
+
+import (
+	"syscall"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestOnTmpfsUsesTmpfs(t *testing.T) {
+	if tmpfsRoot() == "" {
+		t.Skip("no writable tmpfs")
+	}
+	dir := NewDir(t, t.Name(), OnTmpfs())
+	file := NewFile(t, t.Name(), OnTmpfs())
+	for _, path := range []string{dir.Path(), file.Path()} {
+		var stat syscall.Statfs_t
+		assert.NilError(t, syscall.Statfs(path, &stat))
+		assert.Equal(t, int64(stat.Type), int64(tmpfsMagic), path)
+	}
+
+	dir.Remove()
+	assert.ErrorContains(t, OnTmpfs()(dir), "must be the first PathOp")
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package fs
+
+func tmpfsRoot() string {
+	return ""
+}
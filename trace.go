@@ -0,0 +1,142 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// applyState is the state used while PathOps are applied to a File or Dir. It
+// is passed to the entries created by WithFile and WithDir.
+type applyState struct {
+	// ctx stops applying PathOps once it is done.
+	ctx context.Context
+	// logf logs every PathOp when tracing is enabled by FSTEST_TRACE.
+	logf func(format string, args ...interface{})
+	// traced is set when the PathOp which is applied with this state traced
+	// the entry it created, so that the PathOp is not traced again.
+	traced atomic.Bool
+}
+
+// newApplyState returns the state used to apply PathOps for the test t. If the
+// FSTEST_TRACE env var is true every PathOp is logged with t.Logf, with the
+// path, mode, and size of the file or directory after the PathOp was applied.
+func newApplyState(ctx context.Context, t assert.TestingT) *applyState {
+	state := &applyState{ctx: ctx}
+	if logger, ok := t.(interface {
+		Logf(format string, args ...interface{})
+	}); ok && traceEnabled() {
+		state.logf = logger.Logf
+	}
+	return state
+}
+
+func traceEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("FSTEST_TRACE"))
+	return enabled
+}
+
+// applyWithState applies ops to a copy of path which uses state, which is also
+// used for the entries created by the ops. path is not changed, so that a File
+// or Dir can be used by parallel tests.
+func applyWithState(path Path, state *applyState, ops []PathOp) error {
+	switch typed := path.(type) {
+	case *Dir:
+		path = &Dir{path: typed.path, apply: state}
+	case *File:
+		path = &File{path: typed.path, apply: state}
+	default:
+		ops = withContext(state.ctx, ops)
+	}
+	return applyPathOps(path, ops)
+}
+
+// applyToNew applies ops to a File or Dir which was just created, and is not
+// used by anything else yet, so that PathOps such as [In] and
+// [WithCleanupPolicy] can change it.
+func applyToNew(path Path, state *applyState, ops []PathOp) error {
+	previous := setPathState(path, state)
+	defer setPathState(path, previous)
+	return applyPathOps(path, ops)
+}
+
+// pathState returns the state set by applyWithState on a File or Dir, or nil.
+func pathState(path Path) *applyState {
+	switch typed := path.(type) {
+	case *Dir:
+		return typed.apply
+	case *File:
+		return typed.apply
+	}
+	return nil
+}
+
+// setPathState sets the state of a File or Dir, and returns the previous state.
+func setPathState(path Path, state *applyState) *applyState {
+	var previous *applyState
+	switch typed := path.(type) {
+	case *Dir:
+		previous, typed.apply = typed.apply, state
+	case *File:
+		previous, typed.apply = typed.apply, state
+	}
+	return previous
+}
+
+func (s *applyState) err() error {
+	if s == nil || s.ctx == nil {
+		return nil
+	}
+	return s.ctx.Err()
+}
+
+// trace logs the path after the PathOp name was applied to it.
+func (s *applyState) trace(name, path string) {
+	if s == nil || s.logf == nil {
+		return
+	}
+	s.traced.Store(true)
+	info, err := os.Lstat(path)
+	if err != nil {
+		s.logf("fstest: %s %s: %s", name, path, err)
+		return
+	}
+	s.logf("fstest: %s %s: mode %s, size %d", name, path, info.Mode(), info.Size())
+}
+
+// applyOp applies op to path, and traces it unless op traced the entry it
+// created. op is applied with its own state, which records if it traced an
+// entry.
+func (s *applyState) applyOp(op PathOp, path Path) error {
+	if s == nil || s.logf == nil {
+		return op(path)
+	}
+	opState := &applyState{ctx: s.ctx, logf: s.logf}
+	previous := setPathState(path, opState)
+	err := op(path)
+	setPathState(path, previous)
+	if err == nil && !opState.traced.Load() {
+		s.trace(opName(op), path.Path())
+	}
+	return err
+}
+
+// opName returns the name of the function which created op, such as WithFile.
+func opName(op PathOp) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(op).Pointer())
+	if fn == nil {
+		return "PathOp"
+	}
+	name := fn.Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	if parts := strings.Split(name, "."); len(parts) > 1 {
+		return parts[1]
+	}
+	return name
+}
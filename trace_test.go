@@ -0,0 +1,89 @@
+package fs
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestApplyWithTrace(t *testing.T) {
+	t.Setenv("FSTEST_TRACE", "true")
+	dir := NewDir(t, t.Name())
+	defer dir.Remove()
+
+	logT := &logT{}
+	Apply(logT, dir,
+		WithFile("file1", "content", WithMode(0600)),
+		WithDir("sub"),
+		WithMode(0700))
+
+	expected := []string{
+		`^fstest: WithMode \S+file1: mode -rw-------, size 7$`,
+		`^fstest: WithFile \S+file1: mode -rw-------, size 7$`,
+		`^fstest: WithDir \S+sub: mode d`,
+		`^fstest: WithMode \S+TestApplyWithTrace-\d+: mode d`,
+	}
+	if runtime.GOOS == "windows" {
+		expected[0] = `^fstest: WithMode \S+file1: mode -r`
+		expected[1] = `^fstest: WithFile \S+file1: mode -r`
+	}
+	assert.Equal(t, len(logT.lines), len(expected), logT.lines)
+	for i, line := range logT.lines {
+		assert.Assert(t, regexp.MustCompile(expected[i]).MatchString(line), line)
+	}
+}
+
+func TestApplyWithTraceConcurrently(t *testing.T) {
+	t.Setenv("FSTEST_TRACE", "true")
+	dir := NewDir(t, t.Name())
+	defer dir.Remove()
+
+	logT := &logT{}
+	Apply(logT, dir, Concurrently(4,
+		WithFile("file1", ""),
+		WithFile("file2", ""),
+		WithDir("sub", WithMode(0700)),
+		WithSymlink("link", "file1")))
+	assert.Assert(t, dir.apply == nil)
+
+	sort.Strings(logT.lines)
+	expected := []string{
+		`^fstest: WithDir \S+sub: mode d`,
+		`^fstest: WithFile \S+file1: mode -`,
+		`^fstest: WithFile \S+file2: mode -`,
+		`^fstest: WithMode \S+sub: mode d`,
+		`^fstest: WithSymlink \S+TestApplyWithTraceConcurrently-\d+: mode d`,
+	}
+	assert.Equal(t, len(logT.lines), len(expected), logT.lines)
+	for i, line := range logT.lines {
+		assert.Assert(t, regexp.MustCompile(expected[i]).MatchString(line), line)
+	}
+}
+
+func TestApplyWithoutTrace(t *testing.T) {
+	t.Setenv("FSTEST_TRACE", "")
+	dir := NewDir(t, t.Name())
+	defer dir.Remove()
+
+	logT := &logT{}
+	Apply(logT, dir, WithFile("file1", "content"))
+	assert.Equal(t, len(logT.lines), 0)
+}
+
+// logT records the lines logged by a test.
+type logT struct {
+	fakeT
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *logT) Logf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
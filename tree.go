@@ -0,0 +1,111 @@
+package fs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	treeMatch    = "✓"
+	treeMismatch = "✗"
+)
+
+// Tree returns the result of the comparison as a tree of every expected and
+// actual entry. Each entry is marked with ✓ if it matched the expectation or ✗
+// if it did not, and is followed by the description of each mismatch.
+func (r Result) Tree() string {
+	if r.Err != nil {
+		return r.Err.Error()
+	}
+	problems := make(map[string][]string)
+	for _, f := range r.failures {
+		for _, p := range f.problems {
+			path := f.path
+			message := p.String()
+			if p.name != "" {
+				path = filepath.Join(path, p.name)
+				message = strings.TrimPrefix(message, p.name+": ")
+			}
+			problems[path] = append(problems[path], message)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	root := string(os.PathSeparator)
+	writeTreeEntry(buf, problems, "", root, root, r.expected, r.actual)
+	// Mismatches of entries matched by a glob are reported without their
+	// directory, so they may not be found in the tree.
+	for _, path := range sortedProblemPaths(problems) {
+		writeTreeEntry(buf, problems, "", path, path, nil, nil)
+	}
+	return buf.String()
+}
+
+func writeTreeEntry(buf *bytes.Buffer, problems map[string][]string, indent, name, path string, x, y dirEntry) {
+	mark := treeMatch
+	messages, ok := problems[path]
+	if ok {
+		mark = treeMismatch
+	}
+	delete(problems, path)
+	if isDirectory(x) || isDirectory(y) {
+		name = strings.TrimSuffix(name, string(os.PathSeparator)) + string(os.PathSeparator)
+	}
+	buf.WriteString(indent + mark + " " + name + "\n")
+	for _, message := range messages {
+		buf.WriteString(indent + "    " + strings.ReplaceAll(message, "\n", "\n"+indent+"    ") + "\n")
+	}
+
+	xDir, _ := x.(*directory)
+	yDir, _ := y.(*directory)
+	for _, child := range treeChildren(xDir, yDir) {
+		childPath := filepath.Join(path, child)
+		writeTreeEntry(buf, problems, indent+"  ", child, childPath, lookupEntry(xDir, child), lookupEntry(yDir, child))
+	}
+}
+
+func isDirectory(entry dirEntry) bool {
+	_, ok := entry.(*directory)
+	return ok
+}
+
+func lookupEntry(dir *directory, name string) dirEntry {
+	if dir == nil {
+		return nil
+	}
+	return dir.items[name]
+}
+
+// treeChildren returns the sorted names of the expected and actual entries in
+// a directory.
+func treeChildren(x, y *directory) []string {
+	names := make(map[string]bool)
+	for _, dir := range []*directory{x, y} {
+		if dir == nil {
+			continue
+		}
+		for name, entry := range dir.items {
+			if name != anyFile && !isAbsent(entry) {
+				names[name] = true
+			}
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func sortedProblemPaths(problems map[string][]string) []string {
+	paths := make([]string, 0, len(problems))
+	for path := range problems {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}